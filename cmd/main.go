@@ -1,188 +1,262 @@
-package main
-
-import (
-	"context"
-	"errors"
-	"net/http"
-	"os/signal"
-	"sync/atomic"
-	"syscall"
-	"time"
-
-	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"go.uber.org/zap"
-
-	"github.com/duynhne/user-service/config"
-	database "github.com/duynhne/user-service/internal/core"
-	"github.com/duynhne/user-service/internal/core/repository/psql"
-	logicv1 "github.com/duynhne/user-service/internal/logic/v1"
-	webv1 "github.com/duynhne/user-service/internal/web/v1"
-	"github.com/duynhne/user-service/middleware"
-)
-
-func main() {
-	cfg := config.Load()
-	if err := cfg.Validate(); err != nil {
-		panic("Configuration validation failed: " + err.Error())
-	}
-
-	logger, err := middleware.NewLogger()
-	if err != nil {
-		panic("Failed to initialize logger: " + err.Error())
-	}
-	defer func() { _ = logger.Sync() }()
-
-	logger.Info("Service starting",
-		zap.String("service", cfg.Service.Name),
-		zap.String("version", cfg.Service.Version),
-		zap.String("env", cfg.Service.Env),
-		zap.String("port", cfg.Service.Port),
-	)
-
-	tp := initTracing(cfg, logger)
-
-	initProfiling(cfg, logger)
-
-	pool, err := database.Connect(context.Background())
-	if err != nil {
-		logger.Error("Failed to connect to database", zap.Error(err))
-		return
-	}
-	defer pool.Close()
-	logger.Info("Database connection pool established")
-
-	// Initialize Dependency Injection
-	userRepo := psql.NewUserRepository()
-	userService := logicv1.NewUserService(userRepo)
-	userHandler := webv1.NewUserHandler(userService)
-
-	authClient := middleware.NewAuthClient(cfg.AuthServiceURL)
-	logger.Info("Auth client initialized", zap.String("auth_service_url", cfg.AuthServiceURL))
-
-	var isShuttingDown atomic.Bool
-	srv := setupServer(cfg, logger, authClient, &isShuttingDown, userHandler)
-	runGracefulShutdown(cfg, srv, tp, pool, logger, &isShuttingDown)
-}
-
-func initTracing(cfg *config.Config, logger *zap.Logger) interface{ Shutdown(context.Context) error } {
-	if !cfg.Tracing.Enabled {
-		logger.Info("Tracing disabled (TRACING_ENABLED=false)")
-		return nil
-	}
-	tp, err := middleware.InitTracing(cfg)
-	if err != nil {
-		logger.Warn("Failed to initialize tracing", zap.Error(err))
-		return nil
-	}
-	logger.Info("Tracing initialized",
-		zap.String("endpoint", cfg.Tracing.Endpoint),
-		zap.Float64("sample_rate", cfg.Tracing.SampleRate),
-	)
-	return tp
-}
-
-func initProfiling(cfg *config.Config, logger *zap.Logger) {
-	if !cfg.Profiling.Enabled {
-		logger.Info("Profiling disabled (PROFILING_ENABLED=false)")
-		return
-	}
-	if err := middleware.InitProfiling(); err != nil {
-		logger.Warn("Failed to initialize profiling", zap.Error(err))
-		return
-	}
-	logger.Info("Profiling initialized", zap.String("endpoint", cfg.Profiling.Endpoint))
-}
-
-func setupServer(cfg *config.Config, logger *zap.Logger, authClient *middleware.AuthClient, isShuttingDown *atomic.Bool, userHandler *webv1.UserHandler) *http.Server {
-	r := gin.Default()
-
-	r.Use(middleware.TracingMiddleware())
-	r.Use(middleware.LoggingMiddleware(logger))
-	r.Use(middleware.PrometheusMiddleware())
-
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
-	r.GET("/ready", func(c *gin.Context) {
-		if isShuttingDown.Load() {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
-
-	apiV1 := r.Group("/api/v1")
-	{
-		apiV1.GET("/users/:id", userHandler.GetUser)
-		profileGroup := apiV1.Group("/users")
-		profileGroup.Use(middleware.AuthMiddleware(authClient, logger, cfg.AuthAllowUnauthenticatedFallback))
-		{
-			profileGroup.GET("/profile", userHandler.GetProfile)
-			profileGroup.PUT("/profile", userHandler.UpdateProfile)
-		}
-		apiV1.POST("/users", userHandler.CreateUser)
-	}
-
-	return &http.Server{
-		Addr:              ":" + cfg.Service.Port,
-		Handler:           r,
-		ReadHeaderTimeout: 10 * time.Second,
-	}
-}
-
-func runGracefulShutdown(
-	cfg *config.Config,
-	srv *http.Server,
-	tp interface{ Shutdown(context.Context) error },
-	pool interface{ Close() },
-	logger *zap.Logger,
-	isShuttingDown *atomic.Bool,
-) {
-	go func() {
-		logger.Info("Starting user service", zap.String("port", cfg.Service.Port))
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Error("Failed to start server", zap.Error(err))
-		}
-	}()
-
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
-	defer stop()
-
-	<-ctx.Done()
-	logger.Info("Shutdown signal received")
-
-	isShuttingDown.Store(true)
-	drainDelay := cfg.GetReadinessDrainDelayDuration()
-	if drainDelay > 0 {
-		logger.Info("Readiness drain delay started", zap.Duration("delay", drainDelay))
-		time.Sleep(drainDelay)
-	}
-
-	shutdownTimeout := cfg.GetShutdownTimeoutDuration()
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-	defer cancel()
-
-	logger.Info("Shutting down server...", zap.Duration("timeout", shutdownTimeout))
-
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		logger.Error("HTTP server shutdown error", zap.Error(err))
-	} else {
-		logger.Info("HTTP server shutdown complete")
-	}
-
-	pool.Close()
-	logger.Info("Database pool closed")
-
-	if tp != nil {
-		if err := tp.Shutdown(shutdownCtx); err != nil {
-			logger.Error("Tracer shutdown error", zap.Error(err))
-		} else {
-			logger.Info("Tracer shutdown complete")
-		}
-	}
-
-	middleware.StopProfiling()
-	logger.Info("Graceful shutdown complete")
-}
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/config"
+	database "github.com/duynhne/user-service/internal/core"
+	"github.com/duynhne/user-service/internal/core/domain"
+	"github.com/duynhne/user-service/internal/core/repository/psql"
+	"github.com/duynhne/user-service/internal/server"
+	"github.com/duynhne/user-service/middleware"
+)
+
+func main() {
+	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		panic("Configuration validation failed: " + err.Error())
+	}
+
+	logger, err := middleware.NewLoggerFromConfig(cfg)
+	if err != nil {
+		panic("Failed to initialize logger: " + err.Error())
+	}
+	defer func() { _ = logger.Sync() }()
+
+	logger.Info("Service starting",
+		zap.String("service", cfg.Service.Name),
+		zap.String("version", cfg.Service.Version),
+		zap.String("env", cfg.Service.Env),
+		zap.String("port", cfg.Service.Port),
+		zap.String("admin_port", cfg.Service.AdminPort),
+	)
+
+	tp := initTracing(cfg, logger)
+
+	initProfiling(cfg, logger)
+
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), cfg.Timeouts.DBConnect)
+	pools, err := database.Connect(connectCtx, cfg.Database)
+	connectCancel()
+	if err != nil {
+		if database.IsTooManyConnections(err) {
+			database.RecordDBError(database.DBErrorTooManyConnections)
+			logger.Error("PostgreSQL rejected connection: too many connections", zap.Error(err))
+			return
+		}
+		logger.Error("Failed to connect to database", zap.Error(err))
+		return
+	}
+	defer pools.Close()
+	logger.Info("Database connection pool established",
+		zap.String("dsn", cfg.Database.RedactedDSN()),
+		zap.Int32("max_conns", pools.Primary().Config().MaxConns),
+	)
+
+	// Dependencies are built once and injected from here on (no pool globals)
+	app, err := server.NewApp(cfg, logger, pools)
+	if err != nil {
+		logger.Error("Failed to initialize dependencies", zap.Error(err))
+		return
+	}
+
+	// Background work runs under the supervisor so shutdown can wait for it
+	app.Workers.Go("db_pool_stats", func(ctx context.Context) {
+		database.RunPoolStatsSampler(ctx, pools, database.DefaultPoolStatsInterval)
+	})
+
+	if cfg.Database.CredentialReload {
+		watcher, err := database.WatchPasswordFile(pools, cfg.Database.PasswordFile, logger)
+		if err != nil {
+			logger.Error("Failed to start DB credential reload", zap.Error(err))
+			return
+		}
+		app.Workers.Go("db_credential_reload", watcher.Run)
+	}
+
+	if cfg.Database.SeedDemoData {
+		seedDemoData(cfg, app.Repository, logger)
+	}
+
+	middleware.SetExcludedPaths(cfg.Metrics.ExcludePaths)
+	if err := middleware.SetAccessLogFormat(cfg.Logging.AccessLogFormat, os.Stdout); err != nil {
+		logger.Error("Invalid ACCESS_LOG_FORMAT", zap.Error(err))
+		return
+	}
+	middleware.InitDurationMetric(cfg.Metrics.DurationBuckets)
+	middleware.SetDefaultRetryAfter(cfg.GetRetryAfterDuration())
+	if err := domain.SetTimeFormat(cfg.JSONTimeFormat); err != nil {
+		logger.Error("Invalid JSON_TIME_FORMAT", zap.Error(err))
+		return
+	}
+	if err := domain.SetUsernameMaxLength(cfg.UsernameMaxLength); err != nil {
+		logger.Error("Invalid USERNAME_MAX_LENGTH", zap.Error(err))
+		return
+	}
+
+	srv := server.NewServer(cfg, server.NewRouter(cfg, app))
+	var adminSrv *http.Server
+	if admin := server.NewAdminRouter(cfg, app); admin != nil {
+		adminSrv = server.NewAdminServer(cfg, admin)
+	}
+	if cfg.TLS.Enabled() {
+		// Load the certificate now so a bad TLS_CERT_FILE/TLS_KEY_FILE fails startup
+		tlsConfig, err := cfg.TLS.ServerTLSConfig()
+		if err != nil {
+			logger.Error("Invalid TLS configuration", zap.Error(err))
+			return
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	// Bind before serving so port conflicts fail fast with a clear message
+	// instead of surfacing asynchronously from the server goroutine.
+	ln, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", srv.Addr)
+	if err != nil {
+		logger.Error("Failed to bind HTTP listener (is the port already in use?)",
+			zap.String("addr", srv.Addr),
+			zap.Error(err),
+		)
+		return
+	}
+	logger.Info("HTTP listener bound", zap.String("addr", ln.Addr().String()))
+
+	var adminLn net.Listener
+	if adminSrv != nil {
+		adminLn, err = (&net.ListenConfig{}).Listen(context.Background(), "tcp", adminSrv.Addr)
+		if err != nil {
+			_ = ln.Close()
+			logger.Error("Failed to bind admin listener (is ADMIN_PORT already in use?)",
+				zap.String("addr", adminSrv.Addr),
+				zap.Error(err),
+			)
+			return
+		}
+		logger.Info("Admin listener bound", zap.String("addr", adminLn.Addr().String()))
+	}
+
+	runGracefulShutdown(cfg, srv, ln, adminSrv, adminLn, tp, app.Workers, pools,
+		logger, &app.ShuttingDown)
+}
+
+// seedDemoData inserts sample profiles into an empty database (never in production)
+func seedDemoData(cfg *config.Config, repo *psql.UserRepository, logger *zap.Logger) {
+	if cfg.IsProduction() {
+		logger.Warn("SEED_DEMO_DATA ignored in production")
+		return
+	}
+	seeded, err := repo.SeedDemoProfiles(context.Background())
+	if err != nil {
+		logger.Warn("Failed to seed demo data", zap.Error(err))
+		return
+	}
+	if len(seeded) == 0 {
+		logger.Info("Demo data not seeded: user_profiles is not empty")
+		return
+	}
+	userIDs := make([]int, 0, len(seeded))
+	for _, p := range seeded {
+		userIDs = append(userIDs, p.UserID)
+	}
+	logger.Info("Demo data seeded", zap.Int("profiles", len(seeded)), zap.Ints("user_ids", userIDs))
+}
+
+func initTracing(cfg *config.Config, logger *zap.Logger) interface{ Shutdown(context.Context) error } {
+	if !cfg.Tracing.Enabled {
+		logger.Info("Tracing disabled (TRACING_ENABLED=false)")
+		return nil
+	}
+	tp, err := middleware.InitTracing(cfg, logger)
+	if err != nil {
+		logger.Warn("Failed to initialize tracing", zap.Error(err))
+		return nil
+	}
+	logger.Info("Tracing initialized",
+		zap.String("endpoint", cfg.Tracing.Endpoint),
+		zap.Float64("sample_rate", cfg.Tracing.SampleRate),
+	)
+	return tp
+}
+
+func initProfiling(cfg *config.Config, logger *zap.Logger) {
+	if !cfg.Profiling.Enabled {
+		logger.Info("Profiling disabled (PROFILING_ENABLED=false)")
+		return
+	}
+	if err := middleware.InitProfiling(); err != nil {
+		logger.Warn("Failed to initialize profiling", zap.Error(err))
+		return
+	}
+	logger.Info("Profiling initialized", zap.String("endpoint", cfg.Profiling.Endpoint))
+}
+
+func runGracefulShutdown(
+	cfg *config.Config,
+	srv *http.Server,
+	ln net.Listener,
+	adminSrv *http.Server,
+	adminLn net.Listener,
+	tp interface{ Shutdown(context.Context) error },
+	workers *middleware.Supervisor,
+	pool interface{ Close() },
+	logger *zap.Logger,
+	isShuttingDown *atomic.Bool,
+) {
+	go func() {
+		logger.Info("Starting user service",
+			zap.String("port", cfg.Service.Port),
+			zap.String("addr", ln.Addr().String()),
+			zap.Bool("tls", srv.TLSConfig != nil),
+		)
+		serve := srv.Serve
+		if srv.TLSConfig != nil {
+			// Certificates are already in srv.TLSConfig
+			serve = func(ln net.Listener) error { return srv.ServeTLS(ln, "", "") }
+		}
+		if err := serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Failed to start server", zap.Error(err))
+		}
+	}()
+	if adminSrv != nil {
+		go func() {
+			logger.Info("Starting admin server", zap.String("addr", adminLn.Addr().String()))
+			if err := adminSrv.Serve(adminLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Failed to start admin server", zap.Error(err))
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	<-ctx.Done()
+	logger.Info("Shutdown signal received")
+
+	shutdown := &middleware.GracefulShutdown{
+		Logger:       logger,
+		ShuttingDown: isShuttingDown,
+		DrainDelay:   cfg.GetReadinessDrainDelayDuration(),
+		Timeout:      cfg.GetShutdownTimeoutDuration(),
+		Server:       srv,
+		Workers:      workers,
+		Pool:         pool,
+		Tracer:       tp,
+	}
+	if adminSrv != nil {
+		shutdown.AdminServer = adminSrv
+	}
+	if cfg.Profiling.Enabled {
+		shutdown.StopProfiler = middleware.StopProfiling
+		shutdown.ProfilerTimeout = cfg.GetProfilingShutdownTimeoutDuration()
+	}
+	shutdown.Run()
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Secret source names accepted by SECRETS_SOURCE
+const (
+	SecretSourceEnv   = "env"
+	SecretSourceFile  = "file"
+	SecretSourceVault = "vault"
+)
+
+// vaultRequestTimeout bounds a single Vault read at startup
+const vaultRequestTimeout = 5 * time.Second
+
+// SecretSource looks up a named secret (e.g. "DB_PASSWORD").
+// It returns ("", nil) when the source has no value so callers can fall back.
+type SecretSource interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// NewSecretSource returns the source selected by SECRETS_SOURCE:
+//   - env (default): the file named by <NAME>_FILE when set, else the
+//     environment variable itself
+//   - file: the file named by <NAME>_FILE (Kubernetes secret mounts, Vault agent)
+//   - vault: key <NAME> of the KV secret at VAULT_SECRET_PATH on VAULT_ADDR,
+//     authenticated with VAULT_TOKEN
+func NewSecretSource() (SecretSource, error) {
+	switch kind := strings.ToLower(getEnv("SECRETS_SOURCE", SecretSourceEnv)); kind {
+	case SecretSourceEnv:
+		return envSecretSource{}, nil
+	case SecretSourceFile:
+		return fileSecretSource{}, nil
+	case SecretSourceVault:
+		src := vaultSecretSource{
+			addr:   strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+			token:  os.Getenv("VAULT_TOKEN"),
+			path:   strings.Trim(os.Getenv("VAULT_SECRET_PATH"), "/"),
+			client: &http.Client{Timeout: vaultRequestTimeout},
+		}
+		if src.addr == "" || src.token == "" || src.path == "" {
+			return nil, errors.New("SECRETS_SOURCE=vault requires VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH")
+		}
+		return src, nil
+	default:
+		return nil, fmt.Errorf("SECRETS_SOURCE must be one of: env, file, vault (got %q)", kind)
+	}
+}
+
+// ResolveSecret reads name from the configured secret source, falling back to
+// the plain environment variable when the source has no value.
+func ResolveSecret(ctx context.Context, name string) (string, error) {
+	src, err := NewSecretSource()
+	if err != nil {
+		return "", err
+	}
+	value, err := src.Secret(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		value = os.Getenv(name)
+	}
+	return value, nil
+}
+
+type envSecretSource struct{}
+
+// Secret reads a mounted <NAME>_FILE when set, so e.g. DB_PASSWORD_FILE works
+// without SECRETS_SOURCE=file; otherwise it has no value and ResolveSecret
+// falls back to the plain variable.
+func (envSecretSource) Secret(ctx context.Context, name string) (string, error) {
+	return fileSecretSource{}.Secret(ctx, name)
+}
+
+// fileSecretSource reads secrets from the file named by <NAME>_FILE
+type fileSecretSource struct{}
+
+func (fileSecretSource) Secret(_ context.Context, name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	value, err := ReadSecretFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return value, nil
+}
+
+// ReadSecretFile reads a mounted secret file, trimming the trailing newline.
+// Credential reloads use it too, so a rotated value is read exactly like the
+// one loaded at startup.
+func ReadSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %q: %w", path, err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("%q is empty", path)
+	}
+	return value, nil
+}
+
+// vaultSecretSource reads a key from a Vault KV secret (v1 or v2 layout)
+type vaultSecretSource struct {
+	addr   string
+	token  string
+	path   string
+	client *http.Client
+}
+
+func (v vaultSecretSource) Secret(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+v.path, http.NoBody)
+	if err != nil {
+		return "", fmt.Errorf("create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("read vault secret %q: %w", v.path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("read vault secret %q: status %d", v.path, resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode vault secret %q: %w", v.path, err)
+	}
+
+	// KV v2 nests the key/value map under data.data
+	data := body.Data
+	if nested, ok := data["data"]; ok {
+		var kv map[string]json.RawMessage
+		if err := json.Unmarshal(nested, &kv); err == nil {
+			data = kv
+		}
+	}
+	raw, ok := data[name]
+	if !ok {
+		return "", nil
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("vault key %q is not a string", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,3 @@
+-- Verbatim display name (NAME_STORAGE=display_name); NULL means the name is
+-- only stored split into first_name/last_name.
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS display_name VARCHAR(255);
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/config"
+)
+
+// credentialReloadDebounce coalesces the burst of events a secret update produces
+// (Kubernetes swaps the ..data symlink; editors write + chmod + rename)
+const credentialReloadDebounce = 500 * time.Millisecond
+
+// CredentialWatcher reloads the DB password whenever the mounted secret file
+// changes, and swaps in a freshly connected primary pool without downtime:
+// new queries go to the new pool while the old one drains in-flight work and
+// closes (tracked by the PoolSet, so Close waits for it).
+// Shard pools (DB_SHARDS carry their own DSNs) are not reloaded.
+type CredentialWatcher struct {
+	pools   *PoolSet
+	path    string
+	logger  *zap.Logger
+	watcher *fsnotify.Watcher
+}
+
+// WatchPasswordFile starts watching the secret file at path for pools. Run the
+// returned watcher under the app's Supervisor so shutdown stops it before
+// pools is closed.
+func WatchPasswordFile(
+	pools *PoolSet, path string, logger *zap.Logger,
+) (*CredentialWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("create credential watcher: %w", err)
+	}
+	// Watch the directory: secret mounts replace the file via symlink swaps,
+	// which a watch on the file itself would miss.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("watch %q: %w", filepath.Dir(path), err)
+	}
+	logger.Info("DB credential reload enabled", zap.String("file", path))
+	return &CredentialWatcher{pools: pools, path: path, logger: logger, watcher: watcher}, nil
+}
+
+// Run handles file events until ctx is done, then releases the watch.
+func (w *CredentialWatcher) Run(ctx context.Context) {
+	defer w.watcher.Close()
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			debounce = time.After(credentialReloadDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn("Credential watcher error", zap.Error(err))
+		case <-debounce:
+			debounce = nil
+			if err := w.pools.reloadPassword(ctx, w.path, w.logger); err != nil {
+				w.logger.Error("DB credential reload failed; keeping current pool", zap.Error(err))
+			}
+		}
+	}
+}
+
+// reloadPassword rebuilds the primary pool if the password in path changed.
+// The file is read with config.ReadSecretFile, as at startup, and keeps the
+// same precedence: with DB_CREDENTIAL_RELOAD the file is the password source.
+func (s *PoolSet) reloadPassword(ctx context.Context, path string, logger *zap.Logger) error {
+	password, err := config.ReadSecretFile(path)
+	if err != nil {
+		return fmt.Errorf("read password file: %w", err)
+	}
+	current := s.cfg.Load()
+	if password == current.Password {
+		return nil
+	}
+
+	cfg := *current
+	cfg.Password = password
+	pool, err := newPool(ctx, primaryPoolName, cfg.BuildDSN(), cfg.ApplicationName)
+	if err != nil {
+		return fmt.Errorf("connect %s with rotated credential: %w", cfg.RedactedDSN(), err)
+	}
+
+	old := s.primary.Swap(pool)
+	s.cfg.Store(&cfg)
+	logger.Info("DB credential rotated; new pool active",
+		zap.Int32("max_conns", pool.Config().MaxConns))
+
+	// Close blocks until acquired connections are released, draining the old pool
+	s.drains.Go(func() {
+		old.Close()
+		logger.Info("Old DB pool drained and closed")
+	})
+	return nil
+}
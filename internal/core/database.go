@@ -4,83 +4,101 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net"
-	"os"
-	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/duynhne/user-service/config"
 )
 
-// DatabaseConfig holds database connection configuration
-// loaded from environment variables
-type DatabaseConfig struct {
-	Host           string // DB_HOST - PostgreSQL host (e.g., "supporting-db-pooler.user.svc.cluster.local")
-	Port           string // DB_PORT - PostgreSQL port (default: 5432)
-	Name           string // DB_NAME - Database name (e.g., "user")
-	User           string // DB_USER - Database user
-	Password       string // DB_PASSWORD - Database password
-	SSLMode        string // DB_SSLMODE - SSL mode (disable/require/verify-full)
-	MaxConnections int    // DB_POOL_MAX_CONNECTIONS - Max pool connections (default: 25)
+// PoolSet owns the pools opened by Connect: the primary pool and, with
+// DB_SHARDS, one pool per shard. It implements PoolRouter; main hands it to
+// NewApp, the stats sampler and the credential watcher, and closes it last.
+type PoolSet struct {
+	// primary is atomic so credential reloads (WatchPasswordFile) can swap it
+	// under live traffic
+	primary atomic.Pointer[pgxpool.Pool]
+	shards  []*pgxpool.Pool // one per DB_SHARDS entry (nil in single-pool mode)
+	// cfg is the config the primary pool was built from (used for reloads)
+	cfg atomic.Pointer[config.DatabaseConfig]
+	// drains tracks pools replaced by a reload until they finish closing
+	drains sync.WaitGroup
 }
 
-// globalPool is the shared connection pool for the application
-var globalPool *pgxpool.Pool
-
-// LoadConfig loads database configuration from environment variables.
-func LoadConfig() (*DatabaseConfig, error) {
-	cfg := &DatabaseConfig{
-		Host:           getEnv("DB_HOST", ""),
-		Port:           getEnv("DB_PORT", "5432"),
-		Name:           getEnv("DB_NAME", ""),
-		User:           getEnv("DB_USER", ""),
-		Password:       getEnv("DB_PASSWORD", ""),
-		SSLMode:        getEnv("DB_SSLMODE", "disable"),
-		MaxConnections: getEnvInt("DB_POOL_MAX_CONNECTIONS", 25),
-	}
-
-	if cfg.Host == "" {
-		return nil, errors.New("DB_HOST environment variable is required")
-	}
-	if cfg.Name == "" {
-		return nil, errors.New("DB_NAME environment variable is required")
-	}
-	if cfg.User == "" {
-		return nil, errors.New("DB_USER environment variable is required")
+// checkConfig reports the connection fields Connect cannot do without
+func checkConfig(cfg config.DatabaseConfig) error {
+	switch {
+	case cfg.Host == "":
+		return errors.New("DB_HOST (or DATABASE_URL) environment variable is required")
+	case cfg.Name == "":
+		return errors.New("DB_NAME environment variable is required")
+	case cfg.User == "":
+		return errors.New("DB_USER environment variable is required")
+	case cfg.Password == "":
+		return errors.New("DB_PASSWORD environment variable is required")
 	}
-	if cfg.Password == "" {
-		return nil, errors.New("DB_PASSWORD environment variable is required")
-	}
-
-	return cfg, nil
-}
-
-// BuildDSN constructs PostgreSQL connection string (DSN) from config.
-func (c *DatabaseConfig) BuildDSN() string {
-	hostPort := net.JoinHostPort(c.Host, c.Port)
-	return fmt.Sprintf("postgresql://%s:%s@%s/%s?sslmode=%s&pool_max_conns=%d",
-		c.User, c.Password, hostPort, c.Name, c.SSLMode, c.MaxConnections,
-	)
+	return nil
 }
 
-// Connect establishes database connection pool using pgx/v5.
+// Connect establishes the database connection pools using pgx/v5.
 // pgx is used instead of lib/pq for PgBouncer/PgCat compatibility.
+// When DB_SHARDS is set, a pool is also opened per shard DSN (see PoolForUser).
+// cfg comes from config.Load, which has already resolved the password; Connect
+// does not read the environment or secret sources again.
 //
 // IMPORTANT: We use SimpleProtocol mode and disable statement caching to work correctly
 // with transaction-mode connection poolers (PgCat/PgBouncer). Without this, you may see:
 //   "prepared statement stmtcache_* does not exist"
-func Connect(ctx context.Context) (*pgxpool.Pool, error) {
-	cfg, err := LoadConfig()
-	if err != nil {
+func Connect(ctx context.Context, cfg config.DatabaseConfig) (*PoolSet, error) {
+	if err := checkConfig(cfg); err != nil {
 		return nil, fmt.Errorf("failed to load database config: %w", err)
 	}
 
+	pool, err := newPool(ctx, primaryPoolName, cfg.BuildDSN(), cfg.ApplicationName)
+	if err != nil {
+		// Never include BuildDSN() in errors: it carries the password
+		return nil, fmt.Errorf("connect %s: %w", cfg.RedactedDSN(), err)
+	}
+
+	shards := make([]*pgxpool.Pool, 0, len(cfg.Shards))
+	for i, dsn := range cfg.Shards {
+		shardPool, err := newPool(ctx, shardPoolName(i), dsn, cfg.ApplicationName)
+		if err != nil {
+			pool.Close()
+			for _, p := range shards {
+				p.Close()
+			}
+			return nil, fmt.Errorf("connect shard %d: %w", i, err)
+		}
+		shards = append(shards, shardPool)
+	}
+
+	set := &PoolSet{}
+	set.primary.Store(pool)
+	set.cfg.Store(&cfg)
+	if len(shards) > 0 {
+		set.shards = shards
+	}
+	return set, nil
+}
+
+// newPool creates and pings a pool configured for transaction-mode poolers.
+// name labels the pool's metrics (see acquireTracer); appName becomes the
+// connections' application_name unless the DSN already sets one.
+func newPool(ctx context.Context, name, dsn, appName string) (*pgxpool.Pool, error) {
 	// Parse DSN into pool config
-	poolCfg, err := pgxpool.ParseConfig(cfg.BuildDSN())
+	poolCfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database config: %w", err)
 	}
 
+	// Shows up in pg_stat_activity so DBAs can attribute sessions to this service
+	if _, ok := poolCfg.ConnConfig.RuntimeParams["application_name"]; !ok && appName != "" {
+		poolCfg.ConnConfig.RuntimeParams["application_name"] = appName
+	}
+
 	// Configure for transaction-mode poolers (PgCat/PgBouncer):
 	// - Use simple protocol to avoid server-side prepared statements
 	// - Disable statement cache (prepared statements are connection-scoped)
@@ -89,6 +107,9 @@ func Connect(ctx context.Context) (*pgxpool.Pool, error) {
 	poolCfg.ConnConfig.StatementCacheCapacity = 0
 	poolCfg.ConnConfig.DescriptionCacheCapacity = 0
 
+	// Records db_acquire_duration_seconds (pool saturation shows up as acquire wait)
+	poolCfg.ConnConfig.Tracer = acquireTracer{pool: name}
+
 	// Create connection pool with the configured settings
 	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
@@ -100,34 +121,72 @@ func Connect(ctx context.Context) (*pgxpool.Pool, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	globalPool = pool
 	return pool, nil
 }
 
-// GetPool returns the global connection pool.
-func GetPool() *pgxpool.Pool {
-	return globalPool
+// Primary returns the primary pool (the current one after a credential reload)
+func (s *PoolSet) Primary() *pgxpool.Pool {
+	return s.primary.Load()
 }
 
-// GetDB is an alias for GetPool() - provided for backward compatibility.
-//
-// Deprecated: Use GetPool() for new code.
-func GetDB() *pgxpool.Pool {
-	return globalPool
+// PoolForUser returns the pool that owns userID's rows.
+// With DB_SHARDS configured it routes by userID % numShards; otherwise it
+// returns the primary pool.
+func (s *PoolSet) PoolForUser(userID int) *pgxpool.Pool {
+	if len(s.shards) == 0 {
+		return s.primary.Load()
+	}
+	return s.shards[shardIndex(userID, len(s.shards))]
+}
+
+// Pools returns every pool that owns profile rows: the shard pools when
+// DB_SHARDS is set, otherwise just the primary pool.
+func (s *PoolSet) Pools() []*pgxpool.Pool {
+	if len(s.shards) > 0 {
+		return s.shards
+	}
+	return []*pgxpool.Pool{s.primary.Load()}
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Close closes the primary pool and all shard pools, and waits for pools
+// replaced by credential reloads to finish draining.
+func (s *PoolSet) Close() {
+	s.primary.Load().Close()
+	for _, p := range s.shards {
+		p.Close()
 	}
-	return defaultValue
+	s.drains.Wait()
+}
+
+// PoolRouter resolves the pools that own profile rows. Repositories and
+// readiness checks receive one explicitly instead of reading package state,
+// so tests can substitute their own pools.
+type PoolRouter interface {
+	// PoolForUser returns the pool owning userID's rows (nil when none is connected)
+	PoolForUser(userID int) *pgxpool.Pool
+	// Pools returns every pool owning profile rows (empty when none is connected)
+	Pools() []*pgxpool.Pool
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if val := os.Getenv(key); val != "" {
-		if intVal, err := strconv.Atoi(val); err == nil {
-			return intVal
+// PingPools checks every pool of router
+func PingPools(ctx context.Context, router PoolRouter) error {
+	pools := router.Pools()
+	if len(pools) == 0 {
+		return ErrPoolUnavailable
+	}
+	for _, pool := range pools {
+		if err := pool.Ping(ctx); err != nil {
+			return fmt.Errorf("ping database: %w", err)
 		}
 	}
-	return defaultValue
+	return nil
+}
+
+// shardIndex maps userID onto [0, numShards), keeping negative ids in range
+func shardIndex(userID, numShards int) int {
+	idx := userID % numShards
+	if idx < 0 {
+		idx += numShards
+	}
+	return idx
 }
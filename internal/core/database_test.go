@@ -0,0 +1,70 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	database "github.com/duynhne/user-service/internal/core"
+)
+
+func TestShardIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    int
+		numShards int
+		want      int
+	}{
+		{name: "single shard", userID: 42, numShards: 1, want: 0},
+		{name: "zero id", userID: 0, numShards: 4, want: 0},
+		{name: "below N", userID: 3, numShards: 4, want: 3},
+		{name: "wraps at N", userID: 4, numShards: 4, want: 0},
+		{name: "wraps past N", userID: 10, numShards: 4, want: 2},
+		{name: "negative id", userID: -1, numShards: 4, want: 3},
+		{name: "negative multiple of N", userID: -8, numShards: 4, want: 0},
+		{name: "negative past N", userID: -10, numShards: 3, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := database.ShardIndex(tt.userID, tt.numShards); got != tt.want {
+				t.Errorf("shardIndex(%d, %d) = %d, want %d", tt.userID, tt.numShards, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolSetPoolForUser(t *testing.T) {
+	primary := new(pgxpool.Pool)
+	shards := []*pgxpool.Pool{new(pgxpool.Pool), new(pgxpool.Pool), new(pgxpool.Pool)}
+
+	single := database.NewTestPoolSet(primary)
+	for _, userID := range []int{0, 1, 7, -5} {
+		if got := single.PoolForUser(userID); got != primary {
+			t.Errorf("single pool: PoolForUser(%d) is not the primary pool", userID)
+		}
+	}
+	if got := single.Pools(); len(got) != 1 || got[0] != primary {
+		t.Errorf("single pool: Pools() = %v, want just the primary pool", got)
+	}
+
+	sharded := database.NewTestPoolSet(primary, shards...)
+	tests := []struct {
+		userID int
+		want   int
+	}{
+		{userID: 0, want: 0},
+		{userID: 2, want: 2},
+		{userID: 3, want: 0},
+		{userID: 7, want: 1},
+		{userID: -1, want: 2},
+		{userID: -3, want: 0},
+	}
+	for _, tt := range tests {
+		if got := sharded.PoolForUser(tt.userID); got != shards[tt.want] {
+			t.Errorf("sharded: PoolForUser(%d) is not shard %d", tt.userID, tt.want)
+		}
+	}
+	if got := sharded.Pools(); len(got) != len(shards) {
+		t.Errorf("sharded: Pools() has %d pools, want %d", len(got), len(shards))
+	}
+}
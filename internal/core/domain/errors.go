@@ -2,21 +2,113 @@ package domain
 
 import "errors"
 
+// Error is a domain error carrying a stable, machine-readable code.
+// Clients should branch on Code(), not on the human-readable message.
+type Error struct {
+	code    string
+	message string
+}
+
+// NewError creates a domain error with a machine-readable code
+func NewError(code, message string) *Error {
+	return &Error{code: code, message: message}
+}
+
+// Error returns the human-readable message
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Code returns the machine-readable error code (e.g. "user_not_found")
+func (e *Error) Code() string {
+	return e.code
+}
+
+// ErrorCode returns the code of the first domain error in err's chain, or "" if none.
+func ErrorCode(err error) string {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr.Code()
+	}
+	return ""
+}
+
+// RedactedError wraps an infrastructure error whose message must not reach
+// clients (database messages may quote SQL or row values). Error keeps the full
+// message for logs; Detail is the summary safe to show developers.
+type RedactedError struct {
+	Detail string
+	Err    error
+}
+
+// Error returns the wrapped error's full message
+func (e *RedactedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *RedactedError) Unwrap() error {
+	return e.Err
+}
+
 // Sentinel errors for user operations.
 var (
 	// ErrUserNotFound indicates the requested user does not exist.
 	// HTTP Status: 404 Not Found
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound = NewError("user_not_found", "user not found")
+
+	// ErrProfileNotFound indicates the user has no stored profile yet (GetProfile ?strict=true).
+	// HTTP Status: 404 Not Found
+	ErrProfileNotFound = NewError("profile_not_found", "profile not found")
 
 	// ErrUserExists indicates a user with the same username or email already exists.
 	// HTTP Status: 409 Conflict
-	ErrUserExists = errors.New("user already exists")
+	ErrUserExists = NewError("user_exists", "user already exists")
 
 	// ErrInvalidEmail indicates the provided email address is invalid.
 	// HTTP Status: 400 Bad Request
-	ErrInvalidEmail = errors.New("invalid email address")
+	ErrInvalidEmail = NewError("invalid_email", "invalid email address")
+
+	// ErrInvalidName indicates the provided name is empty or whitespace-only.
+	// HTTP Status: 400 Bad Request
+	ErrInvalidName = NewError("invalid_name", "invalid name")
+
+	// ErrNameTooManyParts indicates the name has more than NAME_MAX_PARTS words.
+	// HTTP Status: 400 Bad Request
+	ErrNameTooManyParts = NewError("name_too_many_parts", "name has too many parts")
+
+	// ErrNameTooLong indicates a part of the name exceeds its stored column length
+	// (MaxFirstNameLength, MaxLastNameLength, MaxDisplayNameLength).
+	// HTTP Status: 400 Bad Request
+	ErrNameTooLong = NewError("name_too_long", "name too long")
+
+	// ErrInvalidUsername indicates the username has an invalid length or characters.
+	// HTTP Status: 400 Bad Request
+	ErrInvalidUsername = NewError("invalid_username", "invalid username")
+
+	// ErrServiceBusy indicates a capacity guard (e.g. the transaction limit) rejected the request.
+	// HTTP Status: 503 Service Unavailable
+	ErrServiceBusy = NewError("service_busy", "service busy")
+
+	// ErrDatabaseUnavailable indicates no connection pool exists (before connect
+	// or after a failed connect): an availability problem, not a query failure.
+	// HTTP Status: 503 Service Unavailable
+	ErrDatabaseUnavailable = NewError("database_unavailable", "database connection not available")
 
 	// ErrUnauthorized indicates the user is not authorized to perform the operation.
 	// HTTP Status: 403 Forbidden
-	ErrUnauthorized = errors.New("unauthorized access")
+	ErrUnauthorized = NewError("unauthorized", "unauthorized access")
+
+	// ErrInvalidSort indicates an unknown sort field or order in a list request.
+	// HTTP Status: 400 Bad Request
+	ErrInvalidSort = NewError("invalid_sort", "invalid sort")
+
+	// ErrInvalidUpdateMask indicates an update mask names an unknown or read-only field.
+	// HTTP Status: 400 Bad Request
+	ErrInvalidUpdateMask = NewError("invalid_update_mask", "invalid update mask")
+
+	// ErrPreconditionFailed indicates an If-Match precondition did not match the
+	// stored profile's ETag (it was modified or does not exist).
+	// HTTP Status: 412 Precondition Failed
+	ErrPreconditionFailed = NewError("precondition_failed", "precondition failed")
 )
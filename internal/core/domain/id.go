@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ID is a user/profile identifier. IDs are ints in the database but strings in
+// the API; ID always marshals as a JSON string and unmarshals from either a JSON
+// string ("1") or an integer number (1) so clients sending numeric ids keep working.
+type ID string
+
+// IDFromInt converts a database integer id to an ID
+func IDFromInt(n int) ID {
+	return ID(strconv.Itoa(n))
+}
+
+// String returns the id as a plain string
+func (id ID) String() string {
+	return string(id)
+}
+
+// MarshalJSON always encodes the id as a JSON string
+func (id ID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(id))
+}
+
+// UnmarshalJSON accepts a JSON string or an integer JSON number
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("decode id string: %w", err)
+		}
+		*id = ID(s)
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var n json.Number
+	if err := dec.Decode(&n); err != nil {
+		return fmt.Errorf("decode id number: %w", err)
+	}
+	if _, err := n.Int64(); err != nil {
+		return fmt.Errorf("id must be an integer, got %s", n)
+	}
+	*id = ID(n.String())
+	return nil
+}
@@ -0,0 +1,58 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/duynhne/user-service/internal/core/domain"
+)
+
+func TestIDUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    domain.ID
+		wantErr bool
+	}{
+		{name: "string", input: `{"id":"1"}`, want: "1"},
+		{name: "number", input: `{"id":1}`, want: "1"},
+		{name: "large number", input: `{"id":9007199254740993}`, want: "9007199254740993"},
+		{name: "null", input: `{"id":null}`, want: ""},
+		{name: "float rejected", input: `{"id":1.5}`, wantErr: true},
+		{name: "bool rejected", input: `{"id":true}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				ID domain.ID `json:"id"`
+			}
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got id %q", got.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.ID != tt.want {
+				t.Errorf("id = %q, want %q", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestIDMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(domain.User{ID: domain.IDFromInt(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["id"] != "42" {
+		t.Errorf("id = %#v, want string \"42\"", body["id"])
+	}
+}
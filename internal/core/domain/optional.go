@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// OptionalString is a JSON string field that records whether it was present.
+// A plain string (or *string) cannot tell an omitted field from an explicit
+// null, which matters for partial updates.
+type OptionalString struct {
+	Set   bool   // field was present in the JSON (including null)
+	Null  bool   // field was an explicit null
+	Value string // string value; "" when null
+}
+
+// NewOptionalString returns a set OptionalString holding value
+func NewOptionalString(value string) OptionalString {
+	return OptionalString{Set: true, Value: value}
+}
+
+// UnmarshalJSON is only called for fields present in the input, so any call marks Set
+func (o *OptionalString) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Null, o.Value = true, ""
+		return nil
+	}
+	if err := json.Unmarshal(data, &o.Value); err != nil {
+		return fmt.Errorf("decode optional string: %w", err)
+	}
+	return nil
+}
@@ -1,13 +1,40 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
+
+// ProfileUpdateFunc computes new profile values from the current (locked) profile.
+// current is nil when the user has no profile yet. A non-nil err aborts the
+// update without writing and is returned by UpdateProfileLocked.
+type ProfileUpdateFunc func(current *UserProfile) (name ProfileName, phone string, err error)
 
 // UserRepository defines the interface for user data access
 type UserRepository interface {
 	GetUser(ctx context.Context, id string) (*User, error)
 	GetProfileByUserID(ctx context.Context, userID int) (*UserProfile, error)
-	CreateUserProfile(ctx context.Context, userID int, firstName, lastName string) (int, error)
-	UpdateUserProfile(ctx context.Context, userID int, firstName, lastName, phone string) (bool, error)
-	CheckProfileExists(ctx context.Context, userID int) (bool, error)
-	UpsertUserProfile(ctx context.Context, userID int, firstName, lastName, phone string) error
+	CreateUserProfile(ctx context.Context, userID int, name ProfileName) (int, error)
+	// CreateUserProfileIfAbsent inserts a profile unless one exists for userID;
+	// created is false (and id 0) when the existing row was left untouched.
+	CreateUserProfileIfAbsent(
+		ctx context.Context, userID int, name ProfileName,
+	) (id int, created bool, err error)
+	UpdateUserProfile(ctx context.Context, userID int, name ProfileName, phone string) (bool, error)
+	// CountProfiles returns the number of profiles stored for userID. The UNIQUE
+	// (user_id) constraint is what enforces one profile per user; a duplicate
+	// insert fails with ErrUserExists.
+	CountProfiles(ctx context.Context, userID int) (int, error)
+	CountAllProfiles(ctx context.Context) (int, error)
+	// EstimateProfileCount returns a cheap approximate total for large tables.
+	EstimateProfileCount(ctx context.Context) (int, error)
+	// StreamProfiles calls fn for stored profiles in opts.Sort order (at most
+	// opts.Limit), one row at a time, without buffering the result set. Iteration
+	// stops at the first error from fn or ctx.
+	StreamProfiles(ctx context.Context, opts ProfileListOptions, fn func(*UserProfile) error) error
+	UpsertUserProfile(ctx context.Context, userID int, name ProfileName, phone string) error
+	// UpdateProfileLocked runs apply against the row-locked current profile and
+	// persists its result atomically, serializing concurrent edits of one user.
+	// It returns the new updated_at of the written row.
+	UpdateProfileLocked(ctx context.Context, userID int, apply ProfileUpdateFunc) (time.Time, error)
 }
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Profile list sort fields accepted by the `sort` query parameter.
+const (
+	SortByUserID    = "user_id"
+	SortByCreatedAt = "created_at"
+	SortByName      = "name"
+)
+
+// Sort directions accepted by the `order` query parameter.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ProfileSortFields is the whitelist of sortable profile fields.
+var ProfileSortFields = []string{SortByUserID, SortByCreatedAt, SortByName}
+
+// DefaultProfileSort orders by user_id ascending, which is unique and stable
+// for pagination.
+var DefaultProfileSort = ProfileSort{Field: SortByUserID}
+
+// ProfileListOptions controls a profile listing
+type ProfileListOptions struct {
+	Sort ProfileSort
+	// Limit caps the number of profiles returned (0 = no limit).
+	Limit int
+}
+
+// ProfileSort selects the ordering of profile listings. Field is always one of
+// ProfileSortFields, so repositories can map it to a fixed ORDER BY clause.
+type ProfileSort struct {
+	Field string
+	Desc  bool
+}
+
+// ParseProfileSort validates sort/order query values against the whitelist.
+// Empty values select DefaultProfileSort's field and ascending order.
+func ParseProfileSort(field, order string) (ProfileSort, error) {
+	sort := DefaultProfileSort
+	if field != "" {
+		if !slices.Contains(ProfileSortFields, field) {
+			return ProfileSort{}, fmt.Errorf("sort field %q: %w", field, ErrInvalidSort)
+		}
+		sort.Field = field
+	}
+	switch order {
+	case "", SortAsc:
+	case SortDesc:
+		sort.Desc = true
+	default:
+		return ProfileSort{}, fmt.Errorf("sort order %q: %w", order, ErrInvalidSort)
+	}
+	return sort, nil
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Timestamp wire formats, selected with JSON_TIME_FORMAT.
+const (
+	TimeFormatRFC3339 = "rfc3339" // "2024-01-02T15:04:05.123Z" (default)
+	TimeFormatUnixMs  = "unix_ms" // 1704207845123
+)
+
+// TimeFormats lists the accepted JSON_TIME_FORMAT values.
+var TimeFormats = []string{TimeFormatRFC3339, TimeFormatUnixMs}
+
+var timeFormat atomic.Value // string; read on every MarshalJSON
+
+// SetTimeFormat selects how every Timestamp is encoded. Call it once at startup
+// with a validated value (see config JSON_TIME_FORMAT).
+func SetTimeFormat(format string) error {
+	switch format {
+	case TimeFormatRFC3339, TimeFormatUnixMs:
+		timeFormat.Store(format)
+		return nil
+	}
+	return fmt.Errorf("unknown time format %q (want %s or %s)", format, TimeFormatRFC3339, TimeFormatUnixMs)
+}
+
+// CurrentTimeFormat returns the configured Timestamp format (default: rfc3339)
+func CurrentTimeFormat() string {
+	if format, ok := timeFormat.Load().(string); ok {
+		return format
+	}
+	return TimeFormatRFC3339
+}
+
+// Timestamp is a point in time as exposed in the API. All timestamp fields use
+// it so they serialize the same way: an RFC3339 string (UTC, millisecond
+// precision) or integer epoch milliseconds, per SetTimeFormat. Unmarshalling
+// accepts either form regardless of the configured format. Use the omitzero
+// tag option to drop unknown timestamps from responses.
+type Timestamp struct {
+	time.Time
+}
+
+// NewTimestamp wraps t, truncated to the millisecond precision of the wire format
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{t.UTC().Truncate(time.Millisecond)}
+}
+
+// MarshalJSON encodes the timestamp in the configured format; zero is null
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	if CurrentTimeFormat() == TimeFormatUnixMs {
+		return json.Marshal(t.UnixMilli())
+	}
+	return json.Marshal(t.UTC().Format(time.RFC3339Nano))
+}
+
+// UnmarshalJSON accepts an RFC3339 string or an integer of epoch milliseconds
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("decode timestamp string: %w", err)
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return fmt.Errorf("decode timestamp: %w", err)
+		}
+		*t = Timestamp{parsed.UTC()}
+		return nil
+	}
+
+	var ms int64
+	if err := json.Unmarshal(data, &ms); err != nil {
+		return fmt.Errorf("timestamp must be an RFC3339 string or epoch milliseconds: %w", err)
+	}
+	*t = Timestamp{time.UnixMilli(ms).UTC()}
+	return nil
+}
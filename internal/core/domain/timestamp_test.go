@@ -0,0 +1,88 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/duynhne/user-service/internal/core/domain"
+)
+
+func TestTimestampRoundTrip(t *testing.T) {
+	at := domain.NewTimestamp(time.Date(2024, 1, 2, 15, 4, 5, 123456789, time.UTC))
+
+	tests := []struct {
+		format   string
+		wantJSON string
+	}{
+		{format: domain.TimeFormatRFC3339, wantJSON: `"2024-01-02T15:04:05.123Z"`},
+		{format: domain.TimeFormatUnixMs, wantJSON: `1704207845123`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			setTimeFormat(t, tt.format)
+
+			user := domain.User{ID: "1", CreatedAt: at, UpdatedAt: at}
+			data, err := json.Marshal(user)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("decode fields: %v", err)
+			}
+			for _, key := range []string{"created_at", "updated_at"} {
+				if got := string(fields[key]); got != tt.wantJSON {
+					t.Errorf("%s = %s, want %s", key, got, tt.wantJSON)
+				}
+			}
+
+			var decoded domain.User
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !decoded.CreatedAt.Equal(at.Time) || !decoded.UpdatedAt.Equal(at.Time) {
+				t.Errorf("round trip = %v/%v, want %v", decoded.CreatedAt, decoded.UpdatedAt, at)
+			}
+		})
+	}
+}
+
+func TestTimestampZeroOmitted(t *testing.T) {
+	data, err := json.Marshal(domain.User{ID: "1"})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("decode fields: %v", err)
+	}
+	if _, ok := fields["created_at"]; ok {
+		t.Errorf("zero created_at should be omitted, got %s", data)
+	}
+}
+
+func TestTimestampUnmarshalInvalid(t *testing.T) {
+	for _, input := range []string{`"yesterday"`, `1.5`, `true`} {
+		var ts domain.Timestamp
+		if err := json.Unmarshal([]byte(input), &ts); err == nil {
+			t.Errorf("Unmarshal(%s) expected error, got %v", input, ts)
+		}
+	}
+}
+
+func TestSetTimeFormatRejectsUnknown(t *testing.T) {
+	if err := domain.SetTimeFormat("iso"); err == nil {
+		t.Error("SetTimeFormat(\"iso\") expected error")
+	}
+}
+
+// setTimeFormat switches the global format for one test and restores it after
+func setTimeFormat(t *testing.T, format string) {
+	t.Helper()
+	previous := domain.CurrentTimeFormat()
+	if err := domain.SetTimeFormat(format); err != nil {
+		t.Fatalf("SetTimeFormat(%q): %v", format, err)
+	}
+	t.Cleanup(func() { _ = domain.SetTimeFormat(previous) })
+}
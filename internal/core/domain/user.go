@@ -1,29 +1,206 @@
-package domain
-
-type User struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Name     string `json:"name"`
-	Phone    string `json:"phone,omitempty"`
-}
-
-type UserProfile struct {
-	ID        int
-	UserID    int
-	FirstName *string
-	LastName  *string
-	Phone     *string
-	Address   *string
-}
-
-type CreateUserRequest struct {
-	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Name     string `json:"name" binding:"required"`
-}
-
-type UpdateProfileRequest struct {
-	Name  string `json:"name"`
-	Phone string `json:"phone"`
-}
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+type User struct {
+	ID        ID        `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone,omitempty"`
+	Address   string    `json:"address,omitempty"`
+	CreatedAt Timestamp `json:"created_at,omitzero"`
+	UpdatedAt Timestamp `json:"updated_at,omitzero"`
+	// ETag identifies the stored profile version (see ProfileETag); empty when
+	// no profile is stored. It is sent as the ETag header, not in the body.
+	ETag string `json:"-"`
+}
+
+type UserProfile struct {
+	ID        int
+	UserID    int
+	FirstName *string
+	LastName  *string
+	Phone     *string
+	Address   *string
+	// DisplayName is the verbatim display name (NameStorageDisplayName); nil when
+	// the name is only stored split into FirstName/LastName.
+	DisplayName *string
+	CreatedAt   *time.Time
+	UpdatedAt   *time.Time
+}
+
+// ETag returns the profile's entity tag (see ProfileETag), or "" when
+// updated_at is unknown
+func (p *UserProfile) ETag() string {
+	if p == nil || p.UpdatedAt == nil {
+		return ""
+	}
+	return ProfileETag(*p.UpdatedAt)
+}
+
+// ProfileETag returns the strong entity tag for a profile last written at
+// updatedAt. Every write sets updated_at, so the tag changes with each update;
+// microsecond precision matches PostgreSQL timestamps.
+func ProfileETag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixMicro(), 36) + `"`
+}
+
+// Name returns the stored profile name; NULL columns read as empty
+func (p *UserProfile) Name() ProfileName {
+	var name ProfileName
+	if p.FirstName != nil {
+		name.First = *p.FirstName
+	}
+	if p.LastName != nil {
+		name.Last = *p.LastName
+	}
+	if p.DisplayName != nil {
+		name.Display = *p.DisplayName
+	}
+	return name
+}
+
+// Name storage modes, selected with NAME_STORAGE.
+const (
+	// NameStorageSplit stores only first_name/last_name (see ProfileName).
+	NameStorageSplit = "split"
+	// NameStorageDisplayName also stores the name verbatim in display_name, which
+	// then takes precedence on reads.
+	NameStorageDisplayName = "display_name"
+)
+
+// ProfileName is a display name as persisted on a profile.
+//
+// Split rule: First is the first whitespace-separated word and Last the
+// remaining words joined by single spaces. Runs of whitespace are collapsed, so
+// First + " " + Last does not always reproduce the original name; Display
+// keeps it verbatim when NameStorageDisplayName is selected.
+type ProfileName struct {
+	First   string
+	Last    string
+	Display string // empty unless stored with NameStorageDisplayName
+}
+
+// Stored name lengths in characters, matching the user_profiles columns
+// (first_name/last_name VARCHAR(100), display_name VARCHAR(255)).
+const (
+	MaxFirstNameLength   = 100
+	MaxLastNameLength    = 100
+	MaxDisplayNameLength = 255
+)
+
+// String returns the display name: Display when stored, else First and Last joined
+func (n ProfileName) String() string {
+	if n.Display != "" {
+		return n.Display
+	}
+	return strings.TrimSpace(n.First + " " + n.Last)
+}
+
+// TimestampFrom converts a nullable database timestamp (nil = zero Timestamp)
+func TimestampFrom(t *time.Time) Timestamp {
+	if t == nil {
+		return Timestamp{}
+	}
+	return NewTimestamp(*t)
+}
+
+// Mass-assignment policy for request DTOs:
+//   - Request structs (CreateUserRequest, UpdateProfileRequest) are the allow-list of
+//     client-writable fields. They are bound directly from JSON, so they must never
+//     carry server-controlled attributes (id, user_id, roles, verified, timestamps).
+//   - Server-controlled values are set by the logic layer on domain.User / UserProfile.
+//   - Unknown JSON fields are ignored by binding; privileged fields added to the wire
+//     format by a client therefore have no effect.
+
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Name     string `json:"name" binding:"required"`
+}
+
+// Username length bounds (in characters) enforced by CreateUserRequest.Validate.
+// The maximum is configurable (USERNAME_MAX_LENGTH, see SetUsernameMaxLength).
+const (
+	UsernameMinLength        = 3
+	DefaultUsernameMaxLength = 64
+	// UsernameMaxLengthLimit caps USERNAME_MAX_LENGTH
+	UsernameMaxLengthLimit = 255
+)
+
+var usernameMaxLength atomic.Int64 // 0 = DefaultUsernameMaxLength
+
+// SetUsernameMaxLength sets the longest username CreateUserRequest.Validate
+// accepts. Call it once at startup with a validated value (see config
+// USERNAME_MAX_LENGTH).
+func SetUsernameMaxLength(n int) error {
+	if n < UsernameMinLength || n > UsernameMaxLengthLimit {
+		return fmt.Errorf("username max length must be between %d and %d, got %d",
+			UsernameMinLength, UsernameMaxLengthLimit, n)
+	}
+	usernameMaxLength.Store(int64(n))
+	return nil
+}
+
+// UsernameMaxLength returns the configured maximum username length
+func UsernameMaxLength() int {
+	if n := usernameMaxLength.Load(); n > 0 {
+		return int(n)
+	}
+	return DefaultUsernameMaxLength
+}
+
+// Validate enforces domain rules that binding tags cannot express.
+// Usernames must be UsernameMinLength..UsernameMaxLength() characters of
+// ASCII letters, digits, '.', '_' or '-'.
+func (r CreateUserRequest) Validate() error {
+	n := utf8.RuneCountInString(r.Username)
+	if n < UsernameMinLength || n > UsernameMaxLength() {
+		return ErrInvalidUsername
+	}
+	for _, c := range r.Username {
+		if !isUsernameChar(c) {
+			return ErrInvalidUsername
+		}
+	}
+	return nil
+}
+
+func isUsernameChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '.', c == '_', c == '-':
+		return true
+	}
+	return false
+}
+
+// Updatable profile field names, as used in UpdateProfile update masks.
+const (
+	ProfileFieldName  = "name"
+	ProfileFieldPhone = "phone"
+)
+
+// UpdatableProfileFields lists the fields UpdateProfile can write.
+var UpdatableProfileFields = []string{ProfileFieldName, ProfileFieldPhone}
+
+// UpdateProfileRequest fields are tri-state (see OptionalString):
+//   - omitted:        field is left unchanged
+//   - null or "":     field is cleared
+//   - "value":        field is set
+//
+// An explicit ?update_mask overrides presence: masked fields are written even
+// when omitted (and thus cleared).
+type UpdateProfileRequest struct {
+	Name  OptionalString `json:"name"`
+	Phone OptionalString `json:"phone"`
+}
@@ -0,0 +1,62 @@
+package domain_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/duynhne/user-service/internal/core/domain"
+)
+
+func TestCreateUserRequestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		maxLength int // 0 = default (64)
+		wantErr   bool
+	}{
+		{name: "too short", username: "ab", wantErr: true},
+		{name: "minimum length", username: "abc"},
+		{name: "default maximum", username: strings.Repeat("a", 64)},
+		{name: "over default maximum", username: strings.Repeat("a", 65), wantErr: true},
+		{name: "allowed punctuation", username: "john.doe_2-x"},
+		{name: "space", username: "john doe", wantErr: true},
+		{name: "at sign", username: "john@doe", wantErr: true},
+		{name: "non-ASCII letter", username: "jöhn", wantErr: true},
+		{name: "empty", username: "", wantErr: true},
+		{name: "configured maximum", username: strings.Repeat("a", 16), maxLength: 16},
+		{name: "over configured maximum", username: strings.Repeat("a", 17), maxLength: 16, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxLength := tt.maxLength
+			if maxLength == 0 {
+				maxLength = domain.DefaultUsernameMaxLength
+			}
+			if err := domain.SetUsernameMaxLength(maxLength); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = domain.SetUsernameMaxLength(domain.DefaultUsernameMaxLength) })
+
+			err := domain.CreateUserRequest{Username: tt.username}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate(%q) = %v, wantErr %v", tt.username, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, domain.ErrInvalidUsername) {
+				t.Errorf("Validate(%q) = %v, want ErrInvalidUsername", tt.username, err)
+			}
+		})
+	}
+}
+
+func TestSetUsernameMaxLength(t *testing.T) {
+	t.Cleanup(func() { _ = domain.SetUsernameMaxLength(domain.DefaultUsernameMaxLength) })
+	for _, n := range []int{2, 256} {
+		if err := domain.SetUsernameMaxLength(n); err == nil {
+			t.Errorf("SetUsernameMaxLength(%d) succeeded, want an error", n)
+		}
+	}
+	if err := domain.SetUsernameMaxLength(3); err != nil || domain.UsernameMaxLength() != 3 {
+		t.Errorf("SetUsernameMaxLength(3) = %v, max = %d", err, domain.UsernameMaxLength())
+	}
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/duynhne/user-service/internal/core/domain"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrPoolUnavailable is returned when no connection pool exists (before Connect
+// or after a failed connect); it is domain.ErrDatabaseUnavailable (HTTP 503).
+var ErrPoolUnavailable = domain.ErrDatabaseUnavailable
+
+// pgTooManyConnections is the SQLSTATE PostgreSQL returns when max_connections
+// (or a role/database connection limit) is exhausted.
+const pgTooManyConnections = "53300"
+
+// pgUniqueViolation is the SQLSTATE of a unique constraint violation
+const pgUniqueViolation = "23505"
+
+// DBErrorTooManyConnections is the db_errors_total reason for SQLSTATE 53300
+const DBErrorTooManyConnections = "too_many_connections"
+
+// IsTooManyConnections reports whether err (possibly wrapped, e.g. in a
+// pgconn.ConnectError from a pool acquire) is PostgreSQL's 53300 too_many_connections.
+func IsTooManyConnections(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgTooManyConnections
+}
+
+// IsUniqueViolation reports whether err (possibly wrapped) is PostgreSQL's
+// 23505 unique_violation on constraint.
+func IsUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation &&
+		pgErr.ConstraintName == constraint
+}
+
+// RedactPgError wraps a PostgreSQL error in a domain.RedactedError whose detail
+// is only the SQLSTATE (server messages may quote SQL or row values). Other
+// errors are returned unchanged.
+func RedactPgError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	return &domain.RedactedError{Detail: "database error (SQLSTATE " + pgErr.Code + ")", Err: err}
+}
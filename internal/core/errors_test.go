@@ -0,0 +1,93 @@
+package database_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	database "github.com/duynhne/user-service/internal/core"
+	"github.com/duynhne/user-service/internal/core/domain"
+)
+
+func TestIsTooManyConnections(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "53300", err: &pgconn.PgError{Code: "53300"}, want: true},
+		{
+			name: "wrapped 53300",
+			err:  fmt.Errorf("acquire: %w", &pgconn.PgError{Code: "53300"}),
+			want: true,
+		},
+		{name: "other pg error", err: &pgconn.PgError{Code: "23505"}, want: false},
+		{name: "not a pg error", err: errors.New("connection refused"), want: false},
+		{name: "nil", err: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := database.IsTooManyConnections(tt.err); got != tt.want {
+				t.Errorf("IsTooManyConnections(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	const constraint = "user_profiles_user_id_key"
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "23505 on constraint",
+			err:  &pgconn.PgError{Code: "23505", ConstraintName: constraint},
+			want: true,
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505", ConstraintName: constraint}),
+			want: true,
+		},
+		{
+			name: "other constraint",
+			err:  &pgconn.PgError{Code: "23505", ConstraintName: "user_profiles_pkey"},
+			want: false,
+		},
+		{name: "other pg error", err: &pgconn.PgError{Code: "53300"}, want: false},
+		{name: "nil", err: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := database.IsUniqueViolation(tt.err, constraint); got != tt.want {
+				t.Errorf("IsUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactPgError(t *testing.T) {
+	pgErr := &pgconn.PgError{Code: "42P01", Message: `relation "user_profiles" does not exist`}
+	err := database.RedactPgError(fmt.Errorf("query: %w", pgErr))
+
+	var redacted *domain.RedactedError
+	if !errors.As(err, &redacted) {
+		t.Fatalf("RedactPgError(pg error) = %T, want *domain.RedactedError", err)
+	}
+	if redacted.Detail != "database error (SQLSTATE 42P01)" {
+		t.Errorf("Detail = %q, want only the SQLSTATE", redacted.Detail)
+	}
+	if !errors.Is(err, pgErr) || !strings.Contains(err.Error(), pgErr.Message) {
+		t.Errorf("RedactPgError must keep the original error for logs, got %v", err)
+	}
+
+	plain := errors.New("connection refused")
+	if got := database.RedactPgError(plain); got != plain {
+		t.Errorf("RedactPgError(non-pg error) = %v, want it unchanged", got)
+	}
+}
@@ -0,0 +1,13 @@
+package database
+
+import "github.com/jackc/pgx/v5/pgxpool"
+
+// ShardIndex exposes shardIndex to the external tests
+var ShardIndex = shardIndex
+
+// NewTestPoolSet builds a PoolSet over pools that were never connected
+func NewTestPoolSet(primary *pgxpool.Pool, shards ...*pgxpool.Pool) *PoolSet {
+	set := &PoolSet{shards: shards}
+	set.primary.Store(primary)
+	return set
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Pool names used as the "pool" metric label
+const (
+	primaryPoolName = "primary"
+	shardPoolPrefix = "shard_"
+)
+
+// DefaultPoolStatsInterval is how often RunPoolStatsSampler publishes pool gauges
+const DefaultPoolStatsInterval = 15 * time.Second
+
+var (
+	// acquireDuration buckets start at 100µs: an idle pool hands out connections
+	// almost instantly, so anything in the higher buckets means requests queued.
+	acquireDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_acquire_duration_seconds",
+			Help:    "Time spent waiting to acquire a pooled database connection",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		},
+		[]string{"pool"},
+	)
+
+	poolConns = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_pool_connections",
+			Help: "Pooled database connections by state (acquired, idle, constructing, max)",
+		},
+		[]string{"pool", "state"},
+	)
+
+	dbErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_errors_total",
+			Help: "Database errors that need operator attention, by reason",
+		},
+		[]string{"reason"},
+	)
+
+	poolEmptyAcquireTotal = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "db_pool_empty_acquire_total",
+			Help: "Cumulative acquires that had to wait because the pool had no idle connection",
+		},
+		[]string{"pool"},
+	)
+)
+
+// acquireTracer records db_acquire_duration_seconds for every pool Acquire
+// (including the implicit acquire behind pool.Query/Exec/Begin).
+// pgxpool only calls the acquire hooks when the connection tracer implements
+// pgxpool.AcquireTracer, so the query hooks are no-ops.
+type acquireTracer struct {
+	pool string
+}
+
+type acquireStartKey struct{}
+
+func (t acquireTracer) TraceAcquireStart(
+	ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData,
+) context.Context {
+	return context.WithValue(ctx, acquireStartKey{}, time.Now())
+}
+
+func (t acquireTracer) TraceAcquireEnd(
+	ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireEndData,
+) {
+	if start, ok := ctx.Value(acquireStartKey{}).(time.Time); ok {
+		acquireDuration.WithLabelValues(t.pool).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (t acquireTracer) TraceQueryStart(
+	ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData,
+) context.Context {
+	return ctx
+}
+
+func (t acquireTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// RecordDBError counts a database error by reason (e.g. DBErrorTooManyConnections)
+func RecordDBError(reason string) {
+	dbErrors.WithLabelValues(reason).Inc()
+}
+
+// shardPoolName returns the metric label for shard i
+func shardPoolName(i int) string {
+	return shardPoolPrefix + strconv.Itoa(i)
+}
+
+// RunPoolStatsSampler publishes the statistics of pools as db_pool_* gauges
+// every interval until ctx is done.
+func RunPoolStatsSampler(ctx context.Context, pools *PoolSet, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultPoolStatsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	samplePoolStats(pools)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			samplePoolStats(pools)
+		}
+	}
+}
+
+// samplePoolStats records the current stats of the primary and shard pools
+func samplePoolStats(pools *PoolSet) {
+	recordPoolStats(primaryPoolName, pools.Primary().Stat())
+	for i, pool := range pools.shards {
+		recordPoolStats(shardPoolName(i), pool.Stat())
+	}
+}
+
+func recordPoolStats(name string, stat *pgxpool.Stat) {
+	poolConns.WithLabelValues(name, "acquired").Set(float64(stat.AcquiredConns()))
+	poolConns.WithLabelValues(name, "idle").Set(float64(stat.IdleConns()))
+	poolConns.WithLabelValues(name, "constructing").Set(float64(stat.ConstructingConns()))
+	poolConns.WithLabelValues(name, "max").Set(float64(stat.MaxConns()))
+	poolEmptyAcquireTotal.WithLabelValues(name).Set(float64(stat.EmptyAcquireCount()))
+}
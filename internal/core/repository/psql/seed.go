@@ -0,0 +1,71 @@
+package psql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	database "github.com/duynhne/user-service/internal/core"
+	"github.com/duynhne/user-service/internal/core/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// demoProfiles mirrors db/migrations/sql/V2__seed_user.sql (auth user_ids 1-5)
+var demoProfiles = []struct {
+	userID              int
+	firstName, lastName string
+	phone, address      string
+}{
+	{1, "Alice", "Johnson", "+1-555-0101", "123 Main St, San Francisco, CA 94102"},
+	{2, "Bob", "Smith", "+1-555-0102", "456 Oak Ave, Seattle, WA 98101"},
+	{3, "Carol", "White", "+1-555-0103", "789 Pine Rd, Portland, OR 97201"},
+	{4, "David", "Brown", "+1-555-0104", "321 Elm St, Austin, TX 78701"},
+	{5, "Eve", "Davis", "+1-555-0105", "654 Maple Dr, Boston, MA 02101"},
+}
+
+// SeedDemoProfiles inserts sample profiles when user_profiles is empty on every
+// pool and returns the seeded profiles (nil if data already existed).
+// For local development only; callers must never run it in production.
+func (r *UserRepository) SeedDemoProfiles(ctx context.Context) (_ []domain.UserProfile, err error) {
+	pools := r.pools.Pools()
+	if len(pools) == 0 {
+		return nil, database.ErrPoolUnavailable
+	}
+	ctx, end := r.startQuery(ctx, stmtSeedProfiles)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	for _, db := range pools {
+		var exists bool
+		if err = db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM user_profiles)`).Scan(&exists); err != nil {
+			return nil, r.dbError("check existing profiles", err)
+		}
+		if exists {
+			return nil, nil
+		}
+	}
+
+	query := `INSERT INTO user_profiles (user_id, first_name, last_name, phone, address)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (user_id) DO NOTHING RETURNING id`
+	seeded := make([]domain.UserProfile, 0, len(demoProfiles))
+	for _, p := range demoProfiles {
+		var id int
+		err := r.pools.PoolForUser(p.userID).QueryRow(ctx, query,
+			p.userID, p.firstName, p.lastName, p.phone, p.address,
+		).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue // seeded concurrently by another replica
+		}
+		if err != nil {
+			return seeded, fmt.Errorf("seed profile for user %d: %w", p.userID, err)
+		}
+		seeded = append(seeded, domain.UserProfile{
+			ID:        id,
+			UserID:    p.userID,
+			FirstName: &p.firstName,
+			LastName:  &p.lastName,
+		})
+	}
+	return seeded, nil
+}
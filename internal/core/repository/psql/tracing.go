@@ -0,0 +1,72 @@
+package psql
+
+import (
+	"context"
+
+	"github.com/duynhne/user-service/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dbStatementNameKey carries the static statement name of a repository query.
+// The raw SQL is never attached, so no parameter values can leak into traces.
+const dbStatementNameKey = attribute.Key("db.statement.name")
+
+// dbRowsAffectedKey records how many rows a write touched, so "update did
+// nothing" shows up in traces as db.rows_affected=0.
+const dbRowsAffectedKey = attribute.Key("db.rows_affected")
+
+// statement identifies a repository query for tracing: name becomes the span
+// suffix (db.query.<name>) and operation the db.operation attribute.
+type statement struct {
+	name      string
+	operation string
+}
+
+var (
+	stmtGetProfile          = statement{"get_profile", "SELECT"}
+	stmtCreateProfile       = statement{"create_profile", "INSERT"}
+	stmtCreateProfileIfAbs  = statement{"create_profile_if_absent", "INSERT"}
+	stmtUpdateProfile       = statement{"update_profile", "UPDATE"}
+	stmtCountProfiles       = statement{"count_profiles", "SELECT"}
+	stmtLockProfile         = statement{"lock_profile", "SELECT"}
+	stmtUpdateProfileLocked = statement{"update_profile_locked", "TRANSACTION"}
+	stmtCountAllProfiles    = statement{"count_all_profiles", "SELECT"}
+	stmtEstimateProfiles    = statement{"estimate_profile_count", "SELECT"}
+	stmtStreamProfiles      = statement{"stream_profiles", "SELECT"}
+	stmtUpsertProfile       = statement{"upsert_profile", "INSERT"}
+	stmtSeedProfiles        = statement{"seed_profiles", "INSERT"}
+)
+
+// startQuery opens a db.query.<name> child span following the OTel database
+// semantic conventions. The returned end func records err (if any) on the span
+// and ends it; with query spans disabled both are no-ops.
+func (r *UserRepository) startQuery(ctx context.Context, stmt statement) (context.Context, func(error)) {
+	if !r.querySpans {
+		return ctx, func(error) {}
+	}
+	ctx, span := middleware.StartSpan(ctx, "db.query."+stmt.name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(stmt.operation),
+			dbStatementNameKey.String(stmt.name),
+			attribute.String("layer", "repository"),
+		),
+	)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// recordRowsAffected sets db.rows_affected on the span in ctx: the db.query span,
+// or the caller's span when query spans are disabled.
+func recordRowsAffected(ctx context.Context, n int64) {
+	trace.SpanFromContext(ctx).SetAttributes(dbRowsAffectedKey.Int64(n))
+}
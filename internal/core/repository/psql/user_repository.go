@@ -4,18 +4,123 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	database "github.com/duynhne/user-service/internal/core"
 	"github.com/duynhne/user-service/internal/core/domain"
+	"github.com/duynhne/user-service/middleware"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
 )
 
+// RepositoryOptions tunes UserRepository; zero values select defaults
+type RepositoryOptions struct {
+	// QueryTimeout bounds each query (0 = rely on the caller's context).
+	QueryTimeout time.Duration
+	// MaxConcurrentTx caps simultaneously open transactions per pool so long
+	// transactions cannot starve plain queries of pooled connections (0 = unlimited).
+	MaxConcurrentTx int
+	// Logger receives high-severity database events (nil = no logging).
+	Logger *zap.Logger
+	// QuerySpans emits a db.query.<statement> child span per query (OTEL_DB_QUERY_SPANS).
+	QuerySpans bool
+	// Pools routes queries to the pool owning each user (required; usually the
+	// *database.PoolSet returned by database.Connect).
+	Pools database.PoolRouter
+}
+
 // UserRepository implements domain.UserRepository using PostgreSQL
-type UserRepository struct{}
+type UserRepository struct {
+	queryTimeout time.Duration // per-query timeout (0 = rely on caller's context)
+	maxTx        int           // open transactions allowed per pool (0 = unlimited)
+	txSems       sync.Map      // *pgxpool.Pool -> chan struct{} holding its transaction slots
+	logger       *zap.Logger
+	querySpans   bool // emit db.query.<statement> child spans
+	pools        database.PoolRouter
+}
 
 // NewUserRepository creates a new PostgreSQL user repository
-func NewUserRepository() *UserRepository {
-	return &UserRepository{}
+func NewUserRepository(opts RepositoryOptions) *UserRepository {
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &UserRepository{
+		queryTimeout: opts.QueryTimeout,
+		maxTx:        opts.MaxConcurrentTx,
+		logger:       logger,
+		querySpans:   opts.QuerySpans,
+		pools:        opts.Pools,
+	}
+}
+
+// profileUserIDConstraint is the UNIQUE (user_id) constraint of user_profiles;
+// it enforces the one-profile-per-user invariant
+const profileUserIDConstraint = "user_profiles_user_id_key"
+
+// dbError wraps a database error with op. PostgreSQL rejecting connections
+// (53300 too_many_connections) is mapped to domain.ErrServiceBusy (503 with
+// Retry-After), counted in db_errors_total and logged at error level so SREs
+// can tell pool/server exhaustion apart from ordinary failures. A duplicate
+// user_id (23505 on profileUserIDConstraint) is mapped to domain.ErrUserExists.
+func (r *UserRepository) dbError(op string, err error) error {
+	err = database.RedactPgError(err)
+	if database.IsUniqueViolation(err, profileUserIDConstraint) {
+		return fmt.Errorf("%s: %w: %w", op, domain.ErrUserExists, err)
+	}
+	if database.IsTooManyConnections(err) {
+		database.RecordDBError(database.DBErrorTooManyConnections)
+		r.logger.Error("PostgreSQL rejected connection: too many connections",
+			zap.String("operation", op),
+			zap.Error(err),
+		)
+		return fmt.Errorf("%s: %w: %w", op, domain.ErrServiceBusy, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// acquireTx reserves one of db's transaction slots, waiting until ctx is done
+// (pass the query-timeout context) so short bursts queue instead of failing.
+// If no slot frees up in time it returns domain.ErrServiceBusy (HTTP 503).
+// Each pool has its own slots, sized to its own connections; a pool swapped in
+// by a credential reload starts with fresh ones. The returned release func must
+// be called.
+func (r *UserRepository) acquireTx(
+	ctx context.Context, db *pgxpool.Pool,
+) (release func(), err error) {
+	if r.maxTx <= 0 {
+		return func() {}, nil
+	}
+	v, ok := r.txSems.Load(db)
+	if !ok {
+		v, _ = r.txSems.LoadOrStore(db, make(chan struct{}, r.maxTx))
+	}
+	sem := v.(chan struct{})
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait for transaction slot: %w: %w", domain.ErrServiceBusy, ctx.Err())
+	}
+}
+
+// withTimeout bounds a single query by the configured DB_QUERY_TIMEOUT.
+// The returned cancel func also reports the elapsed time as the request's
+// "db" Server-Timing phase.
+func (r *UserRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	start := time.Now()
+	cancel := context.CancelFunc(func() {})
+	queryCtx := ctx
+	if r.queryTimeout > 0 {
+		queryCtx, cancel = context.WithTimeout(ctx, r.queryTimeout)
+	}
+	return queryCtx, func() {
+		cancel()
+		middleware.RecordDBTime(ctx, time.Since(start))
+	}
 }
 
 // GetUser retrieves a user by ID
@@ -30,110 +135,442 @@ func (r *UserRepository) GetUser(ctx context.Context, id string) (*domain.User,
 	}
 
 	return &domain.User{
-		ID:       id,
+		ID:       domain.ID(id),
 		Username: "user" + id,
 		Email:    "user" + id + "@example.com",
 		Name:     "User " + id,
 	}, nil
 }
 
+// profileColumns is the column list scanned into domain.UserProfile, in field order
+const profileColumns = `id, user_id, first_name, last_name, phone, address, display_name,
+	created_at, updated_at`
+
+// Profile writes shared by the update paths; an empty display name is stored as
+// NULL so reads fall back to first_name/last_name (domain.ProfileName.String).
+const (
+	// Writes bump updated_at (the profile ETag, see domain.ProfileETag);
+	// clock_timestamp() rather than the transaction start keeps serialized
+	// updates distinct.
+	updateProfileQuery = `UPDATE user_profiles
+		SET first_name = $1, last_name = $2, display_name = NULLIF($3, ''), phone = $4,
+			updated_at = clock_timestamp()
+		WHERE user_id = $5 RETURNING updated_at`
+	// insertProfileQuery backs the "no row yet" branch of the upserts. A row
+	// inserted concurrently since the caller looked (SELECT ... FOR UPDATE locks
+	// nothing when the row is absent) is overwritten instead of failing with 23505.
+	insertProfileQuery = `INSERT INTO user_profiles
+		(user_id, first_name, last_name, display_name, phone) VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET first_name = EXCLUDED.first_name, last_name = EXCLUDED.last_name,
+			display_name = EXCLUDED.display_name, phone = EXCLUDED.phone,
+			updated_at = clock_timestamp()
+		RETURNING updated_at`
+)
+
 // GetProfileByUserID retrieves a user profile by user ID
-func (r *UserRepository) GetProfileByUserID(ctx context.Context, userID int) (*domain.UserProfile, error) {
-	db := database.GetPool()
+func (r *UserRepository) GetProfileByUserID(
+	ctx context.Context, userID int,
+) (_ *domain.UserProfile, err error) {
+	db := r.pools.PoolForUser(userID)
 	if db == nil {
-		return nil, errors.New("database connection not available")
+		return nil, database.ErrPoolUnavailable
 	}
+	ctx, end := r.startQuery(ctx, stmtGetProfile)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 
 	var profile domain.UserProfile
-	query := `SELECT id, user_id, first_name, last_name, phone, address FROM user_profiles WHERE user_id = $1`
+	query := `SELECT ` + profileColumns + ` FROM user_profiles WHERE user_id = $1`
 
-	err := db.QueryRow(ctx, query, userID).Scan(
+	err = db.QueryRow(ctx, query, userID).Scan(
 		&profile.ID,
 		&profile.UserID,
 		&profile.FirstName,
 		&profile.LastName,
 		&profile.Phone,
 		&profile.Address,
+		&profile.DisplayName,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil // Return nil if not found, let service handle it
 		}
-		return nil, fmt.Errorf("query user profile: %w", err)
+		return nil, r.dbError("query user profile", err)
 	}
 
 	return &profile, nil
 }
 
 // CreateUserProfile creates a new user profile
-func (r *UserRepository) CreateUserProfile(ctx context.Context, userID int, firstName, lastName string) (int, error) {
-	db := database.GetPool()
+func (r *UserRepository) CreateUserProfile(
+	ctx context.Context, userID int, name domain.ProfileName,
+) (_ int, err error) {
+	db := r.pools.PoolForUser(userID)
 	if db == nil {
-		return 0, errors.New("database connection not available")
+		return 0, database.ErrPoolUnavailable
 	}
+	ctx, end := r.startQuery(ctx, stmtCreateProfile)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 
-	query := `INSERT INTO user_profiles (user_id, first_name, last_name) VALUES ($1, $2, $3) RETURNING id`
+	query := `INSERT INTO user_profiles (user_id, first_name, last_name, display_name)
+		VALUES ($1, $2, $3, NULLIF($4, '')) RETURNING id`
 	var profileID int
-	err := db.QueryRow(ctx, query, userID, firstName, lastName).Scan(&profileID)
+	err = db.QueryRow(ctx, query, userID, name.First, name.Last, name.Display).Scan(&profileID)
 	if err != nil {
-		return 0, fmt.Errorf("insert user profile: %w", err)
+		return 0, r.dbError("insert user profile", err)
 	}
+	recordRowsAffected(ctx, 1)
 	return profileID, nil
 }
 
+// CreateUserProfileIfAbsent inserts a profile with ON CONFLICT (user_id) DO NOTHING,
+// so retries never fail on the unique constraint. created is false on conflict.
+func (r *UserRepository) CreateUserProfileIfAbsent(
+	ctx context.Context, userID int, name domain.ProfileName,
+) (_ int, _ bool, err error) {
+	db := r.pools.PoolForUser(userID)
+	if db == nil {
+		return 0, false, database.ErrPoolUnavailable
+	}
+	ctx, end := r.startQuery(ctx, stmtCreateProfileIfAbs)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO user_profiles (user_id, first_name, last_name, display_name)
+		VALUES ($1, $2, $3, NULLIF($4, '')) ON CONFLICT (user_id) DO NOTHING RETURNING id`
+	var profileID int
+	err = db.QueryRow(ctx, query, userID, name.First, name.Last, name.Display).Scan(&profileID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			recordRowsAffected(ctx, 0)
+			return 0, false, nil // conflict: a profile already exists
+		}
+		return 0, false, r.dbError("insert user profile", err)
+	}
+	recordRowsAffected(ctx, 1)
+	return profileID, true, nil
+}
+
 // UpdateUserProfile updates an existing user profile
 // Returns true if updated, false if not found
-func (r *UserRepository) UpdateUserProfile(ctx context.Context, userID int, firstName, lastName, phone string) (bool, error) {
-	db := database.GetPool()
+func (r *UserRepository) UpdateUserProfile(
+	ctx context.Context, userID int, name domain.ProfileName, phone string,
+) (_ bool, err error) {
+	db := r.pools.PoolForUser(userID)
 	if db == nil {
-		return false, errors.New("database connection not available")
+		return false, database.ErrPoolUnavailable
 	}
+	ctx, end := r.startQuery(ctx, stmtUpdateProfile)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 
-	query := `UPDATE user_profiles SET first_name = $1, last_name = $2, phone = $3 WHERE user_id = $4`
-	result, err := db.Exec(ctx, query, firstName, lastName, phone, userID)
+	result, err := db.Exec(ctx, updateProfileQuery, name.First, name.Last, name.Display, phone, userID)
 	if err != nil {
-		return false, fmt.Errorf("update profile: %w", err)
+		return false, r.dbError("update profile", err)
 	}
 
+	recordRowsAffected(ctx, result.RowsAffected())
 	return result.RowsAffected() > 0, nil
 }
 
-// CheckProfileExists checks if a profile exists for a user ID
-func (r *UserRepository) CheckProfileExists(ctx context.Context, userID int) (bool, error) {
-	db := database.GetPool()
+// CountProfiles returns the number of profiles stored for a user ID
+func (r *UserRepository) CountProfiles(ctx context.Context, userID int) (_ int, err error) {
+	db := r.pools.PoolForUser(userID)
 	if db == nil {
-		return false, errors.New("database connection not available")
+		return 0, database.ErrPoolUnavailable
 	}
+	ctx, end := r.startQuery(ctx, stmtCountProfiles)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 
-	var id int
-	query := `SELECT id FROM user_profiles WHERE user_id = $1`
-	err := db.QueryRow(ctx, query, userID).Scan(&id)
+	var count int
+	query := `SELECT COUNT(*) FROM user_profiles WHERE user_id = $1`
+	if err = db.QueryRow(ctx, query, userID).Scan(&count); err != nil {
+		return 0, r.dbError("count profiles", err)
+	}
+	return count, nil
+}
+
+// GetProfileForUpdate loads a user profile inside tx and locks its row
+// (SELECT ... FOR UPDATE) until tx commits or rolls back. Returns nil, nil if not found.
+//
+// Locking implications:
+//   - The row lock lives as long as tx, so keep the transaction short; other writers
+//     (and other FOR UPDATE readers) of the same user block until it ends.
+//   - Behind a connection pooler (PgBouncer) this needs session or transaction pooling
+//     mode so the whole transaction runs on one server connection; statement mode
+//     breaks multi-statement transactions and must not be used.
+//   - A missing row is not locked, so two first-time writers can still race on insert.
+func (r *UserRepository) GetProfileForUpdate(
+	ctx context.Context, tx pgx.Tx, userID int,
+) (_ *domain.UserProfile, err error) {
+	ctx, end := r.startQuery(ctx, stmtLockProfile)
+	defer func() { end(err) }()
+
+	var profile domain.UserProfile
+	query := `SELECT ` + profileColumns + ` FROM user_profiles WHERE user_id = $1 FOR UPDATE`
+
+	err = tx.QueryRow(ctx, query, userID).Scan(
+		&profile.ID,
+		&profile.UserID,
+		&profile.FirstName,
+		&profile.LastName,
+		&profile.Phone,
+		&profile.Address,
+		&profile.DisplayName,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
+	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return false, nil
+			return nil, nil
 		}
-		return false, fmt.Errorf("check profile exists: %w", err)
+		return nil, r.dbError("lock user profile", err)
+	}
+	return &profile, nil
+}
+
+// UpdateProfileLocked serializes read-modify-write profile edits: it locks the
+// current row with GetProfileForUpdate, lets apply compute the new values, and
+// writes them (update or insert) in the same transaction. A missing row cannot
+// be locked, so two first writes may race; the insert then upserts (see
+// insertProfileQuery) and the later one wins instead of answering 409.
+// It returns the new updated_at; an error from apply rolls back without writing.
+func (r *UserRepository) UpdateProfileLocked(
+	ctx context.Context, userID int, apply domain.ProfileUpdateFunc,
+) (_ time.Time, err error) {
+	db := r.pools.PoolForUser(userID)
+	if db == nil {
+		return time.Time{}, database.ErrPoolUnavailable
+	}
+	ctx, end := r.startQuery(ctx, stmtUpdateProfileLocked)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	release, err := r.acquireTx(ctx, db)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer release()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, r.dbError("begin profile update", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	current, err := r.GetProfileForUpdate(ctx, tx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	name, phone, err := apply(current)
+	if err != nil {
+		recordRowsAffected(ctx, 0)
+		return time.Time{}, err
+	}
+
+	var updatedAt time.Time
+	if current != nil {
+		err = tx.QueryRow(ctx, updateProfileQuery, name.First, name.Last, name.Display, phone, userID).
+			Scan(&updatedAt)
+		if err != nil {
+			return time.Time{}, r.dbError("update profile", err)
+		}
+	} else {
+		err = tx.QueryRow(ctx, insertProfileQuery, userID, name.First, name.Last, name.Display, phone).
+			Scan(&updatedAt)
+		if err != nil {
+			return time.Time{}, r.dbError("create profile", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return time.Time{}, r.dbError("commit profile update", err)
+	}
+	// One row: user_id is unique and RETURNING scanned it
+	recordRowsAffected(ctx, 1)
+	return updatedAt, nil
+}
+
+// CountAllProfiles returns the exact number of profiles across all pools (COUNT(*))
+func (r *UserRepository) CountAllProfiles(ctx context.Context) (_ int, err error) {
+	pools := r.pools.Pools()
+	if len(pools) == 0 {
+		return 0, database.ErrPoolUnavailable
+	}
+	ctx, end := r.startQuery(ctx, stmtCountAllProfiles)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	total := 0
+	for _, db := range pools {
+		var count int
+		if err = db.QueryRow(ctx, `SELECT COUNT(*) FROM user_profiles`).Scan(&count); err != nil {
+			return 0, r.dbError("count all profiles", err)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// EstimateProfileCount returns the planner's row estimate (pg_class.reltuples)
+// summed across pools. It is O(1) but only as fresh as the last ANALYZE/VACUUM;
+// pools whose table was never analyzed fall back to an exact COUNT(*).
+func (r *UserRepository) EstimateProfileCount(ctx context.Context) (_ int, err error) {
+	pools := r.pools.Pools()
+	if len(pools) == 0 {
+		return 0, database.ErrPoolUnavailable
+	}
+	ctx, end := r.startQuery(ctx, stmtEstimateProfiles)
+	defer func() { end(err) }()
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	total := 0
+	for _, db := range pools {
+		var estimate int64
+		query := `SELECT reltuples::bigint FROM pg_class WHERE oid = 'user_profiles'::regclass`
+		if err = db.QueryRow(ctx, query).Scan(&estimate); err != nil {
+			return 0, r.dbError("estimate profile count", err)
+		}
+		if estimate < 0 {
+			// -1 means "never analyzed"
+			if err = db.QueryRow(ctx, `SELECT COUNT(*) FROM user_profiles`).Scan(&estimate); err != nil {
+				return 0, r.dbError("count all profiles", err)
+			}
+		}
+		total += int(estimate)
+	}
+	return total, nil
+}
+
+// StreamProfiles iterates profiles across all pools with pgx.Rows, handing
+// each row to fn as it is read. It is meant for exports, so DB_QUERY_TIMEOUT is
+// not applied; cancel ctx (e.g. client disconnect) to stop the query early.
+// With DB_SHARDS the order holds within each shard; shards are read one after another.
+func (r *UserRepository) StreamProfiles(
+	ctx context.Context, opts domain.ProfileListOptions, fn func(*domain.UserProfile) error,
+) (err error) {
+	pools := r.pools.Pools()
+	if len(pools) == 0 {
+		return database.ErrPoolUnavailable
+	}
+	ctx, end := r.startQuery(ctx, stmtStreamProfiles)
+	defer func() { end(err) }()
+	orderBy, err := profileOrderBy(opts.Sort)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT ` + profileColumns + ` FROM user_profiles ORDER BY ` + orderBy
+	var args []any
+	if opts.Limit > 0 {
+		query += ` LIMIT $1`
+	}
+	remaining := opts.Limit
+	for _, db := range pools {
+		if opts.Limit > 0 {
+			if remaining <= 0 {
+				break
+			}
+			args = []any{remaining}
+		}
+		var rows pgx.Rows
+		rows, err = db.Query(ctx, query, args...)
+		if err != nil {
+			return r.dbError("query profiles", err)
+		}
+		for rows.Next() {
+			var profile domain.UserProfile
+			if err = rows.Scan(
+				&profile.ID,
+				&profile.UserID,
+				&profile.FirstName,
+				&profile.LastName,
+				&profile.Phone,
+				&profile.Address,
+				&profile.DisplayName,
+				&profile.CreatedAt,
+				&profile.UpdatedAt,
+			); err != nil {
+				rows.Close()
+				return r.dbError("scan profile", err)
+			}
+			if err = fn(&profile); err != nil {
+				rows.Close()
+				return err
+			}
+			remaining--
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return r.dbError("iterate profiles", err)
+		}
+	}
+	return nil
+}
+
+// profileOrderColumns maps whitelisted sort fields to fixed column lists; user_id
+// is appended as a unique tie-breaker so the order is stable for pagination.
+var profileOrderColumns = map[string][]string{
+	domain.SortByUserID:    {"user_id"},
+	domain.SortByCreatedAt: {"created_at", "user_id"},
+	domain.SortByName:      {"first_name", "last_name", "user_id"},
+}
+
+// profileOrderBy builds an ORDER BY clause from constants only; request values
+// never reach the SQL text.
+func profileOrderBy(sort domain.ProfileSort) (string, error) {
+	columns, ok := profileOrderColumns[sort.Field]
+	if !ok {
+		return "", fmt.Errorf("sort field %q: %w", sort.Field, domain.ErrInvalidSort)
+	}
+	direction := " ASC"
+	if sort.Desc {
+		direction = " DESC"
+	}
+	clause := make([]string, len(columns))
+	for i, column := range columns {
+		clause[i] = column + direction
 	}
-	return true, nil
+	return strings.Join(clause, ", "), nil
 }
 
 // UpsertUserProfile creates or updates a user profile
-func (r *UserRepository) UpsertUserProfile(ctx context.Context, userID int, firstName, lastName, phone string) error {
+func (r *UserRepository) UpsertUserProfile(
+	ctx context.Context, userID int, name domain.ProfileName, phone string,
+) (err error) {
+	ctx, end := r.startQuery(ctx, stmtUpsertProfile)
+	defer func() { end(err) }()
 	// Try update first
-	updated, err := r.UpdateUserProfile(ctx, userID, firstName, lastName, phone)
+	updated, err := r.UpdateUserProfile(ctx, userID, name, phone)
 	if err != nil {
 		return err
 	}
 	if updated {
+		recordRowsAffected(ctx, 1)
 		return nil
 	}
 
 	// If not updated, create
-	db := database.GetPool()
-	query := `INSERT INTO user_profiles (user_id, first_name, last_name, phone) VALUES ($1, $2, $3, $4)`
-	_, err = db.Exec(ctx, query, userID, firstName, lastName, phone)
+	db := r.pools.PoolForUser(userID)
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	result, err := db.Exec(ctx, insertProfileQuery, userID, name.First, name.Last, name.Display, phone)
 	if err != nil {
-		return fmt.Errorf("create profile: %w", err)
+		return r.dbError("create profile", err)
 	}
+	recordRowsAffected(ctx, result.RowsAffected())
 	return nil
 }
@@ -1,214 +1,563 @@
-package v1
-
-import (
-	"context"
-	"fmt"
-	"strconv"
-	"strings"
-
-	"github.com/duynhne/user-service/internal/core/domain"
-	"github.com/duynhne/user-service/middleware"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/trace"
-)
-
-// UserService defines the business logic for user management
-type UserService struct {
-	repo domain.UserRepository
-}
-
-// NewUserService creates a new user service with injected repository
-func NewUserService(repo domain.UserRepository) *UserService {
-	return &UserService{
-		repo: repo,
-	}
-}
-
-// GetUser retrieves a user by ID
-func (s *UserService) GetUser(ctx context.Context, id string) (*domain.User, error) {
-	_, span := middleware.StartSpan(ctx, "user.get", trace.WithAttributes(
-		attribute.String("layer", "logic"),
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	user, err := s.repo.GetUser(ctx, id)
-	if err != nil {
-		span.SetAttributes(attribute.Bool("user.found", false))
-		// If it's a "not found" error, we might want to wrap it differently
-		// For now, adhering to original logic which mock-failed on "999"
-		return nil, fmt.Errorf("get user by id %q: %w", id, err)
-	}
-
-	span.SetAttributes(attribute.Bool("user.found", true))
-	return user, nil
-}
-
-// GetProfile retrieves the current user's profile
-// userID, username, email are passed from auth middleware (auth service token introspection)
-func (s *UserService) GetProfile(ctx context.Context, userID string, username, email string) (*domain.User, error) {
-	ctx, span := middleware.StartSpan(ctx, "user.profile", trace.WithAttributes(
-		attribute.String("layer", "logic"),
-		attribute.String("user.id", userID),
-	))
-	defer span.End()
-
-	// Parse user_id
-	uid, err := strconv.Atoi(userID)
-	if err != nil {
-		span.SetAttributes(attribute.Bool("profile.found", false))
-		return nil, fmt.Errorf("invalid user_id %q: %w", userID, domain.ErrUserNotFound)
-	}
-
-	// Fetch profile from repository
-	profile, err := s.repo.GetProfileByUserID(ctx, uid)
-	if err != nil {
-		span.RecordError(err)
-		return nil, fmt.Errorf("query user profile: %w", err)
-	}
-
-	// If no profile found, return auth data (legacy/fallback behavior)
-	if profile == nil {
-		span.SetAttributes(attribute.Bool("profile.found", false))
-		return &domain.User{
-			ID:       userID,
-			Username: username,
-			Email:    email,
-			Name:     "User " + userID,
-		}, nil
-	}
-
-	// Build name from profile
-	nameParts := []string{}
-	if profile.FirstName != nil && *profile.FirstName != "" {
-		nameParts = append(nameParts, *profile.FirstName)
-	}
-	if profile.LastName != nil && *profile.LastName != "" {
-		nameParts = append(nameParts, *profile.LastName)
-	}
-	name := strings.Join(nameParts, " ")
-	if name == "" {
-		name = "User " + userID
-	}
-
-	// Build phone string
-	phoneStr := ""
-	if profile.Phone != nil && *profile.Phone != "" {
-		phoneStr = *profile.Phone
-	}
-
-	user := &domain.User{
-		ID:       userID,
-		Username: username,
-		Email:    email,
-		Name:     name,
-		Phone:    phoneStr,
-	}
-
-	span.SetAttributes(attribute.Bool("profile.found", true))
-	return user, nil
-}
-
-// CreateUser creates a new user profile
-func (s *UserService) CreateUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
-	ctx, span := middleware.StartSpan(ctx, "user.create", trace.WithAttributes(
-		attribute.String("layer", "logic"),
-		attribute.String("username", req.Username),
-		attribute.String("email", req.Email),
-	))
-	defer span.End()
-
-	// Validate email format
-	if !strings.Contains(req.Email, "@") {
-		span.SetAttributes(attribute.Bool("user.created", false))
-		return nil, fmt.Errorf("validate email %q for user %q: %w", req.Email, req.Username, domain.ErrInvalidEmail)
-	}
-
-	// Mock production user_id logic (same as before)
-	userID := len(req.Username) + 100
-
-	// Check if profile exists
-	exists, err := s.repo.CheckProfileExists(ctx, userID)
-	if err != nil {
-		span.RecordError(err)
-		return nil, fmt.Errorf("check existing profile: %w", err)
-	}
-	if exists {
-		span.SetAttributes(attribute.Bool("user.created", false))
-		return nil, fmt.Errorf("create user %q: %w", req.Username, domain.ErrUserExists)
-	}
-
-	// Parse name
-	nameParts := strings.Fields(req.Name)
-	var firstName, lastName string
-	if len(nameParts) > 0 {
-		firstName = nameParts[0]
-	}
-	if len(nameParts) > 1 {
-		lastName = strings.Join(nameParts[1:], " ")
-	}
-
-	// Create profile
-	_, err = s.repo.CreateUserProfile(ctx, userID, firstName, lastName)
-	if err != nil {
-		span.RecordError(err)
-		return nil, fmt.Errorf("insert user profile: %w", err)
-	}
-
-	user := &domain.User{
-		ID:       strconv.Itoa(userID),
-		Username: req.Username,
-		Email:    req.Email,
-		Name:     req.Name,
-	}
-
-	span.SetAttributes(
-		attribute.String("user.id", user.ID),
-		attribute.Bool("user.created", true),
-	)
-	span.AddEvent("user.created")
-
-	return user, nil
-}
-
-// UpdateProfile updates the current user's profile
-func (s *UserService) UpdateProfile(ctx context.Context, userID string, req domain.UpdateProfileRequest) (*domain.User, error) {
-	ctx, span := middleware.StartSpan(ctx, "user.update_profile", trace.WithAttributes(
-		attribute.String("layer", "logic"),
-		attribute.String("user_id", userID),
-	))
-	defer span.End()
-
-	// Parse user ID
-	uid := 1
-	if userID != "" {
-		if parsed, err := strconv.Atoi(userID); err == nil {
-			uid = parsed
-		}
-	}
-
-	// Parse name
-	nameParts := strings.Fields(req.Name)
-	var firstName, lastName string
-	if len(nameParts) > 0 {
-		firstName = nameParts[0]
-	}
-	if len(nameParts) > 1 {
-		lastName = strings.Join(nameParts[1:], " ")
-	}
-
-	// Upsert profile
-	err := s.repo.UpsertUserProfile(ctx, uid, firstName, lastName, req.Phone)
-	if err != nil {
-		span.RecordError(err)
-		return nil, fmt.Errorf("upsert profile: %w", err)
-	}
-
-	user := &domain.User{
-		ID:   strconv.Itoa(uid),
-		Name: req.Name,
-	}
-
-	span.SetAttributes(attribute.Bool("profile.updated", true))
-	return user, nil
-}
+package v1
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/duynhne/user-service/internal/core/domain"
+	"github.com/duynhne/user-service/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxProfilesPerUser is the number of profiles a single user_id may own.
+// Profiles are 1:1 with auth users; CreateUser refuses to add another once reached.
+const maxProfilesPerUser = 1
+
+// Operation labels for user_operations_total (see middleware.RecordUserOperation)
+const (
+	opCreateUser    = "create_user"
+	opUpdateProfile = "update_profile"
+)
+
+// ProfileChangeHook is called after a profile update persisted changes to one
+// or more of ServiceOptions.RevalidateFields; fields lists those that changed.
+type ProfileChangeHook func(ctx context.Context, userID string, fields []string)
+
+// ServiceOptions tunes UserService; zero values disable the optional behavior
+type ServiceOptions struct {
+	// RevalidateFields are profile fields (domain.UpdatableProfileFields) whose
+	// change triggers OnRevalidate.
+	RevalidateFields []string
+	// OnRevalidate is called when a change touches RevalidateFields (nil = no-op).
+	OnRevalidate ProfileChangeHook
+	// NameStorage selects how names are persisted: domain.NameStorageSplit
+	// (default) or domain.NameStorageDisplayName.
+	NameStorage string
+	// MaxNameParts rejects names with more whitespace-separated words (0 = unlimited).
+	MaxNameParts int
+}
+
+// UserService defines the business logic for user management
+type UserService struct {
+	repo domain.UserRepository
+	opts ServiceOptions
+}
+
+// NewUserService creates a new user service with injected repository
+func NewUserService(repo domain.UserRepository, opts ServiceOptions) *UserService {
+	return &UserService{
+		repo: repo,
+		opts: opts,
+	}
+}
+
+// GetUser retrieves a user by ID
+func (s *UserService) GetUser(ctx context.Context, id string) (*domain.User, error) {
+	_, span := middleware.StartSpan(ctx, "user.get", trace.WithAttributes(
+		attribute.String("layer", "logic"),
+		attribute.String("user.id", id),
+	))
+	defer span.End()
+
+	user, err := s.repo.GetUser(ctx, id)
+	if err != nil {
+		span.SetAttributes(attribute.Bool("user.found", false))
+		// If it's a "not found" error, we might want to wrap it differently
+		// For now, adhering to original logic which mock-failed on "999"
+		return nil, fmt.Errorf("get user by id %q: %w", id, err)
+	}
+
+	span.SetAttributes(attribute.Bool("user.found", true))
+	return user, nil
+}
+
+// GetProfile retrieves the current user's profile
+// userID, username, email are passed from auth middleware (auth service token introspection)
+// When no profile row exists it returns the auth data with a placeholder name and
+// profileExists = false.
+func (s *UserService) GetProfile(
+	ctx context.Context, userID string, username, email string,
+) (user *domain.User, profileExists bool, err error) {
+	ctx, span := middleware.StartSpan(ctx, "user.profile", trace.WithAttributes(
+		attribute.String("layer", "logic"),
+		attribute.String("user.id", userID),
+	))
+	defer span.End()
+
+	// Parse user_id
+	uid, err := strconv.Atoi(userID)
+	if err != nil {
+		span.SetAttributes(attribute.Bool("profile.found", false))
+		return nil, false, fmt.Errorf("invalid user_id %q: %w", userID, domain.ErrUserNotFound)
+	}
+
+	// Fetch profile from repository
+	profile, err := s.repo.GetProfileByUserID(ctx, uid)
+	if err != nil {
+		span.RecordError(err)
+		return nil, false, fmt.Errorf("query user profile: %w", err)
+	}
+
+	// If no profile found, return auth data (legacy/fallback behavior)
+	if profile == nil {
+		span.SetAttributes(attribute.Bool("profile.found", false))
+		return &domain.User{
+			ID:       domain.ID(userID),
+			Username: username,
+			Email:    email,
+			Name:     "User " + userID,
+		}, false, nil
+	}
+
+	// Build name from profile (display_name when stored, else first + last)
+	name := profile.Name().String()
+	if name == "" {
+		name = "User " + userID
+	}
+
+	// Build phone string
+	phoneStr := ""
+	if profile.Phone != nil && *profile.Phone != "" {
+		phoneStr = *profile.Phone
+	}
+
+	user = &domain.User{
+		ID:        domain.ID(userID),
+		Username:  username,
+		Email:     email,
+		Name:      name,
+		Phone:     phoneStr,
+		Address:   derefString(profile.Address),
+		CreatedAt: domain.TimestampFrom(profile.CreatedAt),
+		UpdatedAt: domain.TimestampFrom(profile.UpdatedAt),
+		ETag:      profile.ETag(),
+	}
+
+	span.SetAttributes(attribute.Bool("profile.found", true))
+	return user, true, nil
+}
+
+// CreateUser creates a new user profile
+// By default an existing profile for the user is a conflict (domain.ErrUserExists).
+// With upsert, the insert is retry-safe (INSERT ... ON CONFLICT DO NOTHING) and an
+// existing profile is returned instead; created reports whether a row was inserted.
+func (s *UserService) CreateUser(
+	ctx context.Context, req domain.CreateUserRequest, upsert bool,
+) (user *domain.User, created bool, err error) {
+	ctx, span := middleware.StartSpan(ctx, "user.create", trace.WithAttributes(
+		attribute.String("layer", "logic"),
+		attribute.String("username", req.Username),
+		attribute.String("email", req.Email),
+		attribute.Bool("request.upsert", upsert),
+	))
+	defer span.End()
+
+	// Enforce username length and charset rules
+	if err := req.Validate(); err != nil {
+		span.SetAttributes(attribute.Bool("user.created", false))
+		// The username is left out: it may be arbitrarily long and would end up in logs
+		return nil, false, fmt.Errorf("validate username: %w", err)
+	}
+
+	// Validate email format
+	if !strings.Contains(req.Email, "@") {
+		span.SetAttributes(attribute.Bool("user.created", false))
+		return nil, false, fmt.Errorf("validate email %q for user %q: %w", req.Email, req.Username, domain.ErrInvalidEmail)
+	}
+
+	// Reject names that are empty once surrounding whitespace is removed
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		span.SetAttributes(attribute.Bool("user.created", false))
+		return nil, false, fmt.Errorf("validate name for user %q: %w", req.Username, domain.ErrInvalidName)
+	}
+
+	// Mock production user_id logic (same as before)
+	userID := len(req.Username) + 100
+
+	// Parse name
+	name, err := s.profileName(req.Name)
+	if err != nil {
+		span.SetAttributes(attribute.Bool("user.created", false))
+		return nil, false, fmt.Errorf("validate name for user %q: %w", req.Username, err)
+	}
+
+	if upsert {
+		return s.createOrGetUser(ctx, span, req, userID, name)
+	}
+
+	// Reject an existing profile early. The UNIQUE (user_id) constraint enforces
+	// the 1:1 user_id -> profile invariant: a concurrent create that passes this
+	// check fails the insert with domain.ErrUserExists (see psql dbError).
+	count, err := s.repo.CountProfiles(ctx, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, false, fmt.Errorf("count existing profiles: %w", err)
+	}
+	if count >= maxProfilesPerUser {
+		span.SetAttributes(
+			attribute.Bool("user.created", false),
+			attribute.Int("user.profile_count", count),
+		)
+		return nil, false, fmt.Errorf("create user %q: %w", req.Username, domain.ErrUserExists)
+	}
+
+	// Create profile
+	_, err = s.repo.CreateUserProfile(ctx, userID, name)
+	if err != nil {
+		span.RecordError(err)
+		return nil, false, fmt.Errorf("insert user profile: %w", err)
+	}
+
+	user = &domain.User{
+		ID:       domain.IDFromInt(userID),
+		Username: req.Username,
+		Email:    req.Email,
+		Name:     req.Name,
+	}
+
+	span.SetAttributes(
+		attribute.String("user.id", user.ID.String()),
+		attribute.Bool("user.created", true),
+	)
+	span.AddEvent("user.created")
+	middleware.RecordUserOperation(opCreateUser, middleware.UserOutcomeCreated)
+
+	return user, true, nil
+}
+
+// createOrGetUser inserts the profile unless one already exists for userID, in
+// which case the stored profile is returned (created = false).
+func (s *UserService) createOrGetUser(
+	ctx context.Context, span trace.Span, req domain.CreateUserRequest, userID int,
+	name domain.ProfileName,
+) (*domain.User, bool, error) {
+	_, created, err := s.repo.CreateUserProfileIfAbsent(ctx, userID, name)
+	if err != nil {
+		span.RecordError(err)
+		return nil, false, fmt.Errorf("insert user profile: %w", err)
+	}
+
+	user := &domain.User{
+		ID:       domain.IDFromInt(userID),
+		Username: req.Username,
+		Email:    req.Email,
+		Name:     req.Name,
+	}
+	if !created {
+		existing, err := s.repo.GetProfileByUserID(ctx, userID)
+		if err != nil {
+			span.RecordError(err)
+			return nil, false, fmt.Errorf("get existing profile: %w", err)
+		}
+		if existing == nil {
+			// Deleted between the insert and the read; let the client retry
+			return nil, false, fmt.Errorf("create user %q: %w", req.Username, domain.ErrUserExists)
+		}
+		user.Name = existing.Name().String()
+		user.Phone = derefString(existing.Phone)
+		user.Address = derefString(existing.Address)
+		user.CreatedAt = domain.TimestampFrom(existing.CreatedAt)
+		user.UpdatedAt = domain.TimestampFrom(existing.UpdatedAt)
+	}
+
+	span.SetAttributes(
+		attribute.String("user.id", user.ID.String()),
+		attribute.Bool("user.created", created),
+	)
+	if created {
+		span.AddEvent("user.created")
+		middleware.RecordUserOperation(opCreateUser, middleware.UserOutcomeCreated)
+	} else {
+		middleware.RecordUserOperation(opCreateUser, middleware.UserOutcomeExisting)
+	}
+	return user, created, nil
+}
+
+// CountProfiles returns the total number of profiles for admin dashboards.
+// approx uses the planner estimate instead of an exact COUNT(*).
+func (s *UserService) CountProfiles(ctx context.Context, approx bool) (int, error) {
+	ctx, span := middleware.StartSpan(ctx, "user.count", trace.WithAttributes(
+		attribute.String("layer", "logic"),
+		attribute.Bool("count.approx", approx),
+	))
+	defer span.End()
+
+	var (
+		total int
+		err   error
+	)
+	if approx {
+		total, err = s.repo.EstimateProfileCount(ctx)
+	} else {
+		total, err = s.repo.CountAllProfiles(ctx)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("count profiles: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("count.total", total))
+	return total, nil
+}
+
+// ExportProfiles streams stored profiles to fn in opts.Sort order, at most
+// opts.Limit (see UserRepository.StreamProfiles)
+func (s *UserService) ExportProfiles(
+	ctx context.Context, opts domain.ProfileListOptions, fn func(*domain.UserProfile) error,
+) error {
+	ctx, span := middleware.StartSpan(ctx, "user.export_profiles", trace.WithAttributes(
+		attribute.String("layer", "logic"),
+		attribute.String("export.sort", opts.Sort.Field),
+		attribute.Bool("export.sort_desc", opts.Sort.Desc),
+		attribute.Int("export.limit", opts.Limit),
+	))
+	defer span.End()
+
+	exported := 0
+	err := s.repo.StreamProfiles(ctx, opts, func(p *domain.UserProfile) error {
+		exported++
+		return fn(p)
+	})
+	span.SetAttributes(attribute.Int("export.profiles", exported))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("export profiles: %w", err)
+	}
+	return nil
+}
+
+// UpdateProfileOptions tune a single UpdateProfile call; the zero value is an
+// unconditional upsert of the fields present in the request.
+type UpdateProfileOptions struct {
+	// UpdateMask optionally restricts which fields are written (see
+	// domain.UpdatableProfileFields). Empty writes the fields present in req
+	// (omitted fields are left unchanged, null/"" clear).
+	UpdateMask []string
+	// IfMatch holds If-Match entity tags ("*" = any stored profile). When set the
+	// update fails with domain.ErrPreconditionFailed unless the locked row's ETag
+	// is listed.
+	IfMatch []string
+	// RequireExisting fails with domain.ErrProfileNotFound instead of creating
+	// the profile when the user has none.
+	RequireExisting bool
+}
+
+// UpdateProfile updates the current user's profile, creating it when missing
+// unless opts.RequireExisting is set. Fields outside opts.UpdateMask keep their
+// stored values.
+// It also returns the fields whose stored value actually changed (diffed against the
+// locked current row), in domain.UpdatableProfileFields order. The returned user
+// carries the new ETag.
+func (s *UserService) UpdateProfile(
+	ctx context.Context, userID string, req domain.UpdateProfileRequest, opts UpdateProfileOptions,
+) (*domain.User, []string, error) {
+	ctx, span := middleware.StartSpan(ctx, "user.update_profile", trace.WithAttributes(
+		attribute.String("layer", "logic"),
+		attribute.String("user_id", userID),
+	))
+	defer span.End()
+
+	fields, err := resolveUpdateMask(opts.UpdateMask, req)
+	if err != nil {
+		span.SetAttributes(attribute.Bool("profile.updated", false))
+		return nil, nil, err
+	}
+
+	// Parse user ID
+	uid := 1
+	if userID != "" {
+		if parsed, err := strconv.Atoi(userID); err == nil {
+			uid = parsed
+		}
+	}
+
+	// Validate the new name before taking the row lock
+	var newName domain.ProfileName
+	if fields[domain.ProfileFieldName] {
+		if newName, err = s.profileName(req.Name.Value); err != nil {
+			span.SetAttributes(attribute.Bool("profile.updated", false))
+			return nil, nil, fmt.Errorf("validate name: %w", err)
+		}
+	}
+
+	var name domain.ProfileName
+	var phone string
+	var changed []string
+	outcome := middleware.UserOutcomeUpdated
+	apply := func(current *domain.UserProfile) (domain.ProfileName, string, error) {
+		if len(opts.IfMatch) > 0 && !etagMatches(opts.IfMatch, current) {
+			return domain.ProfileName{}, "", domain.ErrPreconditionFailed
+		}
+		if current == nil && opts.RequireExisting {
+			return domain.ProfileName{}, "", domain.ErrProfileNotFound
+		}
+		if current == nil {
+			outcome = middleware.UserOutcomeAutoCreated
+		}
+		var oldName, oldPhone string
+		if current != nil {
+			name = current.Name()
+			phone = derefString(current.Phone)
+			oldName, oldPhone = name.String(), phone
+		}
+		if fields[domain.ProfileFieldName] {
+			name = newName
+		}
+		if fields[domain.ProfileFieldPhone] {
+			phone = req.Phone.Value
+		}
+
+		changed = make([]string, 0, len(domain.UpdatableProfileFields))
+		if name.String() != oldName {
+			changed = append(changed, domain.ProfileFieldName)
+		}
+		if phone != oldPhone {
+			changed = append(changed, domain.ProfileFieldPhone)
+		}
+		return name, phone, nil
+	}
+
+	// Merge with the stored values under a row lock so concurrent partial edits
+	// don't overwrite each other's fields and the diff reflects what persisted
+	updatedAt, err := s.repo.UpdateProfileLocked(ctx, uid, apply)
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.Bool("profile.updated", false))
+		return nil, nil, fmt.Errorf("update profile with lock: %w", err)
+	}
+
+	user := &domain.User{
+		ID:        domain.IDFromInt(uid),
+		Name:      name.String(),
+		Phone:     phone,
+		UpdatedAt: domain.NewTimestamp(updatedAt),
+		ETag:      domain.ProfileETag(updatedAt),
+	}
+
+	span.SetAttributes(
+		attribute.Bool("profile.updated", true),
+		attribute.String("profile.outcome", outcome),
+		attribute.StringSlice("profile.updated_fields", changed),
+	)
+	middleware.RecordUserOperation(opUpdateProfile, outcome)
+	s.notifyRevalidate(ctx, user.ID.String(), changed)
+	return user, changed, nil
+}
+
+// etagMatches reports whether the If-Match tags select current. Comparison is
+// strong (RFC 9110): weak tags never match, and "*" matches any stored profile.
+func etagMatches(ifMatch []string, current *domain.UserProfile) bool {
+	if current == nil {
+		return false
+	}
+	etag := current.ETag()
+	for _, tag := range ifMatch {
+		if tag == "*" || (etag != "" && tag == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyRevalidate calls OnRevalidate with the changed fields listed in RevalidateFields
+func (s *UserService) notifyRevalidate(ctx context.Context, userID string, changed []string) {
+	if s.opts.OnRevalidate == nil {
+		return
+	}
+	var fields []string
+	for _, f := range changed {
+		if slices.Contains(s.opts.RevalidateFields, f) {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) > 0 {
+		s.opts.OnRevalidate(ctx, userID, fields)
+	}
+}
+
+// resolveUpdateMask validates mask entries against the updatable fields and
+// returns the set of fields to write. An empty mask selects the fields present
+// in req, so omitted fields are never overwritten.
+func resolveUpdateMask(mask []string, req domain.UpdateProfileRequest) (map[string]bool, error) {
+	fields := make(map[string]bool, len(domain.UpdatableProfileFields))
+	if len(mask) == 0 {
+		if req.Name.Set {
+			fields[domain.ProfileFieldName] = true
+		}
+		if req.Phone.Set {
+			fields[domain.ProfileFieldPhone] = true
+		}
+		return fields, nil
+	}
+	for _, f := range mask {
+		f = strings.TrimSpace(f)
+		if !slices.Contains(domain.UpdatableProfileFields, f) {
+			return nil, fmt.Errorf("update mask field %q: %w", f, domain.ErrInvalidUpdateMask)
+		}
+		fields[f] = true
+	}
+	return fields, nil
+}
+
+// profileName converts a display name into its stored form (see domain.ProfileName
+// for the split rule). Names with more than MaxNameParts words are rejected with
+// domain.ErrNameTooManyParts and names whose parts do not fit their columns with
+// domain.ErrNameTooLong; with NameStorageDisplayName the trimmed name is also
+// kept verbatim.
+func (s *UserService) profileName(name string) (domain.ProfileName, error) {
+	first, last, ok := splitName(name, s.opts.MaxNameParts)
+	if !ok {
+		return domain.ProfileName{}, fmt.Errorf("name has more than %d parts: %w",
+			s.opts.MaxNameParts, domain.ErrNameTooManyParts)
+	}
+	stored := domain.ProfileName{First: first, Last: last}
+	if s.opts.NameStorage == domain.NameStorageDisplayName {
+		stored.Display = strings.TrimSpace(name)
+	}
+	// Checked here so an overlong name is a 400, not a 500 from PostgreSQL (22001)
+	if utf8.RuneCountInString(stored.First) > domain.MaxFirstNameLength ||
+		utf8.RuneCountInString(stored.Last) > domain.MaxLastNameLength ||
+		utf8.RuneCountInString(stored.Display) > domain.MaxDisplayNameLength {
+		return domain.ProfileName{}, fmt.Errorf("name of %d characters: %w",
+			utf8.RuneCountInString(name), domain.ErrNameTooLong)
+	}
+	return stored, nil
+}
+
+// MaxNameParts returns the configured word limit for names (0 = unlimited)
+func (s *UserService) MaxNameParts() int {
+	return s.opts.MaxNameParts
+}
+
+// splitName splits a display name into the first word and the remaining words.
+// ok is false when the name has more than maxParts words (0 = unlimited); the
+// scan stops there, so oversized names are never fully tokenized.
+func splitName(name string, maxParts int) (firstName, lastName string, ok bool) {
+	var rest []string
+	parts := 0
+	for part := range strings.FieldsSeq(name) {
+		parts++
+		if maxParts > 0 && parts > maxParts {
+			return "", "", false
+		}
+		if parts == 1 {
+			firstName = part
+			continue
+		}
+		rest = append(rest, part)
+	}
+	return firstName, strings.Join(rest, " "), true
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/config"
+	database "github.com/duynhne/user-service/internal/core"
+	"github.com/duynhne/user-service/internal/core/repository/psql"
+	logicv1 "github.com/duynhne/user-service/internal/logic/v1"
+	webv1 "github.com/duynhne/user-service/internal/web/v1"
+	"github.com/duynhne/user-service/middleware"
+)
+
+// App holds the service's dependencies. main builds it once with NewApp and
+// passes it to NewRouter; tests fill in only the fields they exercise.
+type App struct {
+	Logger *zap.Logger
+	// Pools routes profile queries; injected into the repository and the db readiness check
+	Pools        database.PoolRouter
+	Repository   *psql.UserRepository
+	Service      *logicv1.UserService
+	UserHandler  *webv1.UserHandler
+	AuthClient   *middleware.AuthClient
+	InternalAuth *middleware.InternalAuth // nil when INTERNAL_AUTH_* is unset
+	// Workers supervises background goroutines so shutdown can wait for them
+	Workers *middleware.Supervisor
+	// ShuttingDown fails /ready once shutdown starts (see middleware.GracefulShutdown)
+	ShuttingDown atomic.Bool
+	// ReadinessChecks are the dependencies /ready probes
+	ReadinessChecks []middleware.ReadinessCheck
+}
+
+// NewApp constructs every dependency from cfg on top of pools (usually the
+// *database.PoolSet returned by database.Connect).
+func NewApp(cfg *config.Config, logger *zap.Logger, pools database.PoolRouter) (*App, error) {
+	app := &App{
+		Logger:  logger,
+		Pools:   pools,
+		Workers: middleware.NewSupervisor(logger),
+	}
+
+	app.Repository = psql.NewUserRepository(psql.RepositoryOptions{
+		QueryTimeout:    cfg.Timeouts.DBQuery,
+		MaxConcurrentTx: cfg.Database.MaxConcurrentTx,
+		Logger:          logger,
+		QuerySpans:      cfg.Tracing.QuerySpans,
+		Pools:           pools,
+	})
+	app.Service = logicv1.NewUserService(app.Repository, logicv1.ServiceOptions{
+		RevalidateFields: cfg.ProfileRevalidateFields,
+		NameStorage:      cfg.NameStorage,
+		MaxNameParts:     cfg.NameMaxParts,
+		OnRevalidate: func(_ context.Context, userID string, fields []string) {
+			logger.Info("Profile change requires re-validation",
+				zap.String("user_id", userID),
+				zap.Strings("fields", fields),
+			)
+		},
+	})
+	trustedProxies, err := middleware.NewTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	app.UserHandler = webv1.NewUserHandler(app.Service, webv1.HandlerOptions{
+		ProfileCacheMaxAge: cfg.GetProfileCacheMaxAgeDuration(),
+		MaxJSONDepth:       cfg.MaxJSONDepth,
+		MaxBodyBytes:       int64(cfg.MaxBodyBytes),
+		TrustedProxies:     trustedProxies,
+		AllowPublicSignup:  cfg.AllowPublicSignup,
+		PublicUserFields:   cfg.PublicUserFields,
+		RoutePrefix:        cfg.RoutePrefix,
+		StrictQueryParams:  cfg.StrictQueryParams,
+		ListMaxLimit:       cfg.ListMaxLimit,
+
+		UpdateRequiresProfile: !cfg.UpdateProfileCreate,
+		ErrorDetail:           cfg.IsDevelopment(),
+	})
+
+	var tokenCache middleware.TokenCache
+	if ttl := cfg.GetAuthCacheTTLDuration(); ttl > 0 {
+		tokenCache = middleware.NewMemoryTokenCache(ttl, cfg.AuthCache.MaxEntries, logger)
+	}
+	app.AuthClient = middleware.NewAuthClient(cfg.AuthServiceURL, middleware.AuthClientOptions{
+		Cache:            tokenCache,
+		Timeout:          cfg.Timeouts.AuthClient,
+		MaxResponseBytes: int64(cfg.AuthMaxResponseBytes),
+		MaxConcurrent:    cfg.AuthMaxConcurrent,
+	})
+	logger.Info("Auth client initialized",
+		zap.String("auth_service_url", cfg.AuthServiceURL),
+		zap.Duration("cache_ttl", cfg.GetAuthCacheTTLDuration()),
+	)
+
+	if app.InternalAuth, err = newInternalAuth(cfg, logger); err != nil {
+		return nil, fmt.Errorf("initialize internal auth: %w", err)
+	}
+	app.ReadinessChecks = readinessChecks(cfg, pools, app.AuthClient)
+	return app, nil
+}
+
+func newInternalAuth(cfg *config.Config, logger *zap.Logger) (*middleware.InternalAuth, error) {
+	if !cfg.InternalAuth.Enabled() {
+		return nil, nil
+	}
+	internalAuth, err := middleware.NewInternalAuth(
+		cfg.InternalAuth.Header,
+		cfg.InternalAuth.Secret,
+		cfg.InternalAuth.TrustedCIDRs,
+		cfg.GetInternalAuthMaxSkewDuration(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Internal service auth enabled",
+		zap.String("header", internalAuth.Header()),
+		zap.Strings("trusted_cidrs", cfg.InternalAuth.TrustedCIDRs),
+	)
+	return internalAuth, nil
+}
+
+// readinessChecks lists the dependencies /ready probes; READINESS_REQUIRED_CHECKS
+// decides which of them fail readiness
+func readinessChecks(
+	cfg *config.Config, pools database.PoolRouter, authClient *middleware.AuthClient,
+) []middleware.ReadinessCheck {
+	required := func(name string) bool { return slices.Contains(cfg.ReadinessRequiredChecks, name) }
+	checks := []middleware.ReadinessCheck{{
+		Name:     middleware.ReadinessCheckDB,
+		Required: required(middleware.ReadinessCheckDB),
+		Check: middleware.CachedCheck(cfg.ReadinessDBCheckTTL, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, cfg.Timeouts.DBQuery)
+			defer cancel()
+			return database.PingPools(ctx, pools)
+		}),
+	}}
+	if cfg.ReadinessCheckAuth {
+		checks = append(checks, middleware.ReadinessCheck{
+			Name:     middleware.ReadinessCheckAuth,
+			Required: required(middleware.ReadinessCheckAuth),
+			Check:    authClient.CheckHealth,
+		})
+	}
+	return checks
+}
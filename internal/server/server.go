@@ -0,0 +1,120 @@
+// Package server builds the production HTTP router and servers, so tests can
+// exercise the exact wiring main uses with injected fakes.
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/duynhne/user-service/config"
+	webv1 "github.com/duynhne/user-service/internal/web/v1"
+	"github.com/duynhne/user-service/middleware"
+)
+
+// readHeaderTimeout bounds how long a client may take to send request headers
+const readHeaderTimeout = 10 * time.Second
+
+// NewRouter builds the public router: probes, GET /, the API routes declared by
+// UserHandler.Routes and, without ADMIN_PORT, the admin endpoints (see NewAdminRouter).
+// It panics if the routes cannot be registered, which is a programming error.
+func NewRouter(cfg *config.Config, app *App) *gin.Engine {
+	r := gin.Default()
+
+	r.Use(middleware.TracingMiddleware())
+	r.Use(middleware.LoggingMiddleware(app.Logger, cfg.Logging.HealthChecks))
+	if cfg.ServerTimingEnabled {
+		r.Use(middleware.ServerTimingMiddleware())
+	}
+	r.Use(middleware.PrometheusMiddleware())
+	if cfg.Service.ExposeIdentity {
+		r.Use(middleware.ServerIdentityMiddleware())
+	}
+
+	r.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+	r.GET("/ready", middleware.ReadinessHandler(app.Logger, &app.ShuttingDown, app.ReadinessChecks))
+	if cfg.RootDescriptor {
+		r.GET("/", middleware.RootHandler(cfg.Service.Name, cfg.Service.Version,
+			rootEndpoints(cfg, app.UserHandler.Routes())))
+	}
+
+	// With ADMIN_PORT, metrics and debug endpoints move to their own server
+	if cfg.Service.AdminPort == "" {
+		registerAdminRoutes(r, cfg)
+	}
+
+	// JSON responses for unmatched routes; trailing-slash variants are not redirected
+	middleware.ConfigureFallbackRoutes(r)
+
+	// Routes and their auth requirements are declared in webv1 (UserHandler.Routes).
+	// ROUTE_PREFIX mounts them under a gateway path; c.FullPath() (and so the
+	// route-template metric labels) includes the prefix.
+	api := r.Group(cfg.RoutePrefix)
+	authMiddleware := middleware.AuthMiddleware(app.AuthClient, app.Logger,
+		cfg.AuthAllowUnauthenticatedFallback, app.InternalAuth)
+	if err := webv1.RegisterRoutes(api, app.UserHandler.Routes(), authMiddleware); err != nil {
+		panic("Failed to register routes: " + err.Error())
+	}
+	return r
+}
+
+// NewAdminRouter builds the ADMIN_PORT router serving /metrics and the
+// non-production /debug/* endpoints; nil when ADMIN_PORT is unset.
+// It traces and logs requests like NewRouter, so /debug/trace reports the
+// same trace ids on either port.
+func NewAdminRouter(cfg *config.Config, app *App) *gin.Engine {
+	if cfg.Service.AdminPort == "" {
+		return nil
+	}
+	r := gin.Default()
+	r.Use(middleware.TracingMiddleware())
+	r.Use(middleware.LoggingMiddleware(app.Logger, cfg.Logging.HealthChecks))
+	middleware.ConfigureFallbackRoutes(r)
+	registerAdminRoutes(r, cfg)
+	return r
+}
+
+// NewServer returns the public HTTP server on PORT
+func NewServer(cfg *config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.Service.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+}
+
+// NewAdminServer returns the admin HTTP server on ADMIN_PORT
+func NewAdminServer(cfg *config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.Service.AdminPort,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+}
+
+// registerAdminRoutes adds the metrics and (outside production) debug endpoints;
+// they share the main server unless ADMIN_PORT gives them their own
+func registerAdminRoutes(r gin.IRoutes, cfg *config.Config) {
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	if !cfg.IsProduction() {
+		r.GET("/debug/trace", middleware.TraceDebugHandler(cfg.Tracing.Enabled, cfg.Tracing.SampleRate))
+		r.POST("/debug/trace/flush", middleware.TraceFlushHandler(cfg))
+		r.GET("/debug/config", middleware.ConfigDebugHandler(cfg))
+	}
+}
+
+// rootEndpoints lists the probe and API endpoints advertised by GET /
+func rootEndpoints(cfg *config.Config, specs []webv1.RouteSpec) []string {
+	endpoints := []string{"GET /health", "GET /ready"}
+	if cfg.Service.AdminPort == "" {
+		endpoints = append(endpoints, "GET /metrics")
+	}
+	for _, spec := range specs {
+		endpoints = append(endpoints, spec.Method+" "+cfg.RoutePrefix+spec.Path)
+	}
+	return endpoints
+}
@@ -0,0 +1,202 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/config"
+	database "github.com/duynhne/user-service/internal/core"
+	logicv1 "github.com/duynhne/user-service/internal/logic/v1"
+	"github.com/duynhne/user-service/internal/server"
+	webv1 "github.com/duynhne/user-service/internal/web/v1"
+	"github.com/duynhne/user-service/middleware"
+)
+
+// newTestApp wires a router whose auth service rejects every token and whose
+// repository is never reached (requests stop at auth or probe handlers).
+func newTestApp(t *testing.T) *server.App {
+	t.Helper()
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(auth.Close)
+
+	service := logicv1.NewUserService(nil, logicv1.ServiceOptions{})
+	return &server.App{
+		Logger:      zap.NewNop(),
+		AuthClient:  middleware.NewAuthClient(auth.URL, middleware.AuthClientOptions{}),
+		UserHandler: webv1.NewUserHandler(service, webv1.HandlerOptions{}),
+		ReadinessChecks: []middleware.ReadinessCheck{{
+			Name:     middleware.ReadinessCheckDB,
+			Required: true,
+			Check:    func(context.Context) error { return nil },
+		}},
+	}
+}
+
+func serve(t *testing.T, h http.Handler, method, path string) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, http.NoBody))
+	return w.Code
+}
+
+func TestNewRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		adminPort  string
+		env        string
+		method     string
+		path       string
+		wantStatus int
+		wantAdmin  int // status on the admin router (0 = no admin router)
+	}{
+		{name: "health", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK},
+		{name: "ready", method: http.MethodGet, path: "/ready", wantStatus: http.StatusOK},
+		{name: "root descriptor", method: http.MethodGet, path: "/", wantStatus: http.StatusOK},
+		{name: "metrics", method: http.MethodGet, path: "/metrics", wantStatus: http.StatusOK},
+		{
+			name: "debug config", env: "development",
+			method: http.MethodGet, path: "/debug/config", wantStatus: http.StatusOK,
+		},
+		{
+			name: "no debug endpoints in production", env: "production",
+			method: http.MethodGet, path: "/debug/config", wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "API requires auth", method: http.MethodGet, path: "/api/v1/users/profile",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{name: "unknown route", method: http.MethodGet, path: "/nope", wantStatus: http.StatusNotFound},
+		{
+			name: "admin port serves metrics", adminPort: "9090",
+			method: http.MethodGet, path: "/metrics",
+			wantStatus: http.StatusNotFound, wantAdmin: http.StatusOK,
+		},
+		{
+			name: "admin port serves debug", adminPort: "9090", env: "development",
+			method: http.MethodGet, path: "/debug/config",
+			wantStatus: http.StatusNotFound, wantAdmin: http.StatusOK,
+		},
+		{
+			name: "admin port keeps probes public", adminPort: "9090",
+			method: http.MethodGet, path: "/ready",
+			wantStatus: http.StatusOK, wantAdmin: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := tt.env
+			if env == "" {
+				env = "development"
+			}
+			cfg := &config.Config{
+				Service: config.ServiceConfig{
+					Name: "user", Env: env, Port: "8080", AdminPort: tt.adminPort,
+				},
+				RootDescriptor: true,
+			}
+			app := newTestApp(t)
+			r := server.NewRouter(cfg, app)
+
+			if got := serve(t, r, tt.method, tt.path); got != tt.wantStatus {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, got, tt.wantStatus)
+			}
+			admin := server.NewAdminRouter(cfg, app)
+			if (admin != nil) != (tt.wantAdmin != 0) {
+				t.Fatalf("admin router = %v, want one: %v", admin != nil, tt.wantAdmin != 0)
+			}
+			if admin == nil {
+				return
+			}
+			if got := serve(t, admin, tt.method, tt.path); got != tt.wantAdmin {
+				t.Errorf("admin %s %s = %d, want %d", tt.method, tt.path, got, tt.wantAdmin)
+			}
+		})
+	}
+}
+
+func TestNewAdminRouterTracesRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Service: config.ServiceConfig{Name: "user", Env: "development", AdminPort: "9090"},
+	}
+	admin := server.NewAdminRouter(cfg, newTestApp(t))
+
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/trace", http.NoBody))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /debug/trace = %d, want %d", w.Code, http.StatusOK)
+	}
+	var body struct {
+		LogTraceID string `json:"log_trace_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.LogTraceID == "" || body.LogTraceID != w.Header().Get(middleware.TraceIDHeader) {
+		t.Errorf("log_trace_id = %q, want the %s header %q",
+			body.LogTraceID, middleware.TraceIDHeader, w.Header().Get(middleware.TraceIDHeader))
+	}
+}
+
+func TestNewRouterReadinessDuringShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{Service: config.ServiceConfig{Name: "user", Env: "development"}}
+	app := newTestApp(t)
+	r := server.NewRouter(cfg, app)
+
+	app.ShuttingDown.Store(true)
+	t.Cleanup(func() { middleware.SetShutdownInProgress(false) })
+	if got := serve(t, r, http.MethodGet, "/ready"); got != http.StatusServiceUnavailable {
+		t.Errorf("GET /ready while shutting down = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	cfg := &config.Config{Service: config.ServiceConfig{Port: "8080", AdminPort: "9090"}}
+	if srv := server.NewServer(cfg, http.NotFoundHandler()); srv.Addr != ":8080" {
+		t.Errorf("NewServer addr = %q, want :8080", srv.Addr)
+	}
+	if srv := server.NewAdminServer(cfg, http.NotFoundHandler()); srv.Addr != ":9090" {
+		t.Errorf("NewAdminServer addr = %q, want :9090", srv.Addr)
+	}
+}
+
+// noPools is a database.PoolRouter with nothing connected
+type noPools struct{}
+
+func (noPools) PoolForUser(int) *pgxpool.Pool { return nil }
+func (noPools) Pools() []*pgxpool.Pool        { return nil }
+
+func TestNewAppInjectsPools(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Service:                 config.ServiceConfig{Name: "user", Env: "development"},
+		ReadinessRequiredChecks: []string{middleware.ReadinessCheckDB},
+	}
+	app, err := server.NewApp(cfg, zap.NewNop(), noPools{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := server.NewRouter(cfg, app)
+
+	// The db readiness check and the repository both go through the injected pools
+	if got := serve(t, r, http.MethodGet, "/ready"); got != http.StatusServiceUnavailable {
+		t.Errorf("GET /ready without pools = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+	_, err = app.Repository.CountAllProfiles(t.Context())
+	if !errors.Is(err, database.ErrPoolUnavailable) {
+		t.Errorf("CountAllProfiles err = %v, want ErrPoolUnavailable", err)
+	}
+}
@@ -0,0 +1,145 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/duynhne/user-service/internal/core/domain"
+	"github.com/duynhne/user-service/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes for failures that don't originate from a domain error.
+const (
+	codeInternal        = "internal_error"
+	codeInvalidRequest  = "invalid_request"
+	codeUnauthenticated = middleware.CodeUnauthenticated
+	codeForbidden       = "forbidden"
+)
+
+// errorMapping maps a domain sentinel error to its HTTP status and client message.
+// The machine-readable code comes from the domain error itself.
+type errorMapping struct {
+	err     *domain.Error
+	status  int
+	message string
+}
+
+// errorMappings is the single source of truth for sentinel error -> HTTP translation.
+// New sentinel errors only need an entry here.
+var errorMappings = []errorMapping{
+	{domain.ErrUserNotFound, http.StatusNotFound, "User not found"},
+	{domain.ErrProfileNotFound, http.StatusNotFound, "Profile not found"},
+	{domain.ErrUserExists, http.StatusConflict, "User already exists"},
+	{domain.ErrInvalidEmail, http.StatusBadRequest, "Invalid email address"},
+	{domain.ErrInvalidName, http.StatusBadRequest, "Name must not be empty"},
+	{domain.ErrNameTooManyParts, http.StatusBadRequest, ""}, // see UserHandler.message
+	{domain.ErrNameTooLong, http.StatusBadRequest,
+		fmt.Sprintf("Name is too long: at most %d characters, %d in the first word and %d in the rest",
+			domain.MaxDisplayNameLength, domain.MaxFirstNameLength, domain.MaxLastNameLength)},
+	{domain.ErrInvalidUsername, http.StatusBadRequest, ""}, // see UserHandler.message
+	{domain.ErrUnauthorized, http.StatusForbidden, "Unauthorized access"},
+	{domain.ErrInvalidUpdateMask, http.StatusBadRequest, "Invalid update_mask"},
+	{domain.ErrInvalidSort, http.StatusBadRequest,
+		"sort must be one of user_id, created_at, name and order one of asc, desc"},
+	{domain.ErrPreconditionFailed, http.StatusPreconditionFailed,
+		"Profile was modified; fetch it again and retry with the current ETag"},
+	{domain.ErrServiceBusy, http.StatusServiceUnavailable, "Service busy, please retry"},
+	{domain.ErrDatabaseUnavailable, http.StatusServiceUnavailable, "Database unavailable, please retry"},
+}
+
+// httpStatusForError maps an error (possibly wrapped) to an HTTP status and error code.
+// Unknown errors map to 500 internal_error.
+func httpStatusForError(err error) (int, string) {
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			return m.status, m.err.Code()
+		}
+	}
+	return http.StatusInternalServerError, codeInternal
+}
+
+// messageForCode returns the client-facing message for an error code.
+func messageForCode(code string) string {
+	for _, m := range errorMappings {
+		if m.err.Code() == code {
+			return m.message
+		}
+	}
+	return "Internal server error"
+}
+
+// message returns the client-facing message for code. Messages stating a
+// configurable limit (USERNAME_MAX_LENGTH, NAME_MAX_PARTS) are built per response.
+func (h *UserHandler) message(code string) string {
+	switch code {
+	case domain.ErrInvalidUsername.Code():
+		return fmt.Sprintf("Username must be %d-%d characters of letters, digits, '.', '_' or '-'",
+			domain.UsernameMinLength, domain.UsernameMaxLength())
+	case domain.ErrNameTooManyParts.Code():
+		return fmt.Sprintf("Name must have at most %d words", h.service.MaxNameParts())
+	}
+	return messageForCode(code)
+}
+
+// errorBody builds the standard error envelope (see middleware.ErrorBody).
+func errorBody(code, message string) gin.H {
+	return middleware.ErrorBody(code, message)
+}
+
+// respondError writes the standard error JSON for err.
+// 429/503 responses carry Retry-After (see middleware.SetRetryAfter).
+// With HandlerOptions.ErrorDetail the envelope also carries "detail" (see errorDetail).
+func (h *UserHandler) respondError(c *gin.Context, err error) {
+	status, code := httpStatusForError(err)
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		middleware.SetRetryAfter(c, 0)
+	}
+	body := errorBody(code, h.message(code))
+	if h.opts.ErrorDetail {
+		if detail := errorDetail(err); detail != "" {
+			body["detail"] = detail
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, body)
+}
+
+// maxErrorDetailLength caps the "detail" field of error responses
+const maxErrorDetailLength = 300
+
+var (
+	// sqlPattern matches the start of an SQL statement; everything after it is dropped
+	sqlPattern = regexp.MustCompile(`(?i)\b(select\s.+\sfrom|insert\s+into|update\s+\S+\s+set|` +
+		`delete\s+from|with\s+\S+\s+as\s*\()`)
+	// pathPattern matches absolute file paths such as /app/internal/core/database.go
+	pathPattern = regexp.MustCompile(`(^|[\s"'(=])/[\w.-]+(/[\w.-]+)+`)
+)
+
+// errorDetail returns a debugging detail for err that is safe to show to developers.
+// Errors redacted by the repository (domain.RedactedError, e.g. PostgreSQL errors
+// reduced to their SQLSTATE) use their Detail; otherwise SQL statements are cut
+// off and file paths are replaced with "<path>".
+func errorDetail(err error) string {
+	var redacted *domain.RedactedError
+	if errors.As(err, &redacted) {
+		return redacted.Detail
+	}
+	detail := err.Error()
+	if loc := sqlPattern.FindStringIndex(detail); loc != nil {
+		detail = detail[:loc[0]] + "<sql>"
+	}
+	detail = pathPattern.ReplaceAllString(detail, "$1<path>")
+	if len(detail) > maxErrorDetailLength {
+		detail = detail[:maxErrorDetailLength] + "..."
+	}
+	return detail
+}
+
+// writeError writes an error envelope. Error responses are never cacheable.
+func writeError(c *gin.Context, status int, code, message string) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, errorBody(code, message))
+}
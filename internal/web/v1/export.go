@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/internal/core/domain"
+	"github.com/duynhne/user-service/middleware"
+)
+
+// formatNDJSON selects newline-delimited JSON output (one object per line)
+const formatNDJSON = "ndjson"
+
+// ndjsonContentType is the media type for newline-delimited JSON
+const ndjsonContentType = "application/x-ndjson"
+
+// profileExportLine is one NDJSON line of a profile export
+type profileExportLine struct {
+	ID          domain.ID        `json:"id"`
+	FirstName   string           `json:"first_name,omitempty"`
+	LastName    string           `json:"last_name,omitempty"`
+	DisplayName string           `json:"display_name,omitempty"`
+	Phone       string           `json:"phone,omitempty"`
+	Address     string           `json:"address,omitempty"`
+	CreatedAt   domain.Timestamp `json:"created_at,omitzero"`
+	UpdatedAt   domain.Timestamp `json:"updated_at,omitzero"`
+}
+
+// ListUsers handles GET /api/v1/users?format=ndjson[&sort=user_id|created_at|name&order=asc|desc]
+// (default: sort=user_id&order=asc). The optional limit must not exceed LIST_MAX_LIMIT,
+// which is also applied when limit is absent.
+// Profiles are streamed row by row as NDJSON and flushed after each line, so the
+// export is never buffered (the response is chunked since no Content-Length is
+// known). A client disconnect cancels the query.
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
+		attribute.String("layer", "web"),
+		attribute.String("method", c.Request.Method),
+		attribute.String("path", c.Request.URL.Path),
+	))
+	defer endRequestSpan(c, span)
+
+	loggerVal, exists := c.Get("logger")
+	var zapLogger *zap.Logger
+	if exists {
+		if l, ok := loggerVal.(*zap.Logger); ok {
+			zapLogger = l
+		}
+	}
+	if zapLogger == nil {
+		zapLogger, _ = middleware.NewLogger()
+	}
+
+	// Only the streaming export exists; a buffered JSON listing is intentionally not offered
+	if c.Query("format") != formatNDJSON {
+		writeError(c, http.StatusBadRequest, codeInvalidRequest, "format must be ndjson")
+		return
+	}
+
+	sort, err := domain.ParseProfileSort(c.Query("sort"), c.Query("order"))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	limit, err := parseListLimit(c, h.opts.ListMaxLimit)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	started := false
+	enc := json.NewEncoder(c.Writer)
+	opts := domain.ProfileListOptions{Sort: sort, Limit: limit}
+	err = h.service.ExportProfiles(ctx, opts, func(p *domain.UserProfile) error {
+		if !started {
+			started = true
+			c.Header("Content-Type", ndjsonContentType)
+			c.Header("Cache-Control", "no-store")
+			c.Status(http.StatusOK)
+		}
+		line := profileExportLine{
+			ID:          domain.IDFromInt(p.UserID),
+			FirstName:   derefOrEmpty(p.FirstName),
+			LastName:    derefOrEmpty(p.LastName),
+			DisplayName: derefOrEmpty(p.DisplayName),
+			Phone:       derefOrEmpty(p.Phone),
+			Address:     derefOrEmpty(p.Address),
+			CreatedAt:   domain.TimestampFrom(p.CreatedAt),
+			UpdatedAt:   domain.TimestampFrom(p.UpdatedAt),
+		}
+		// Encode appends the newline that terminates each NDJSON record
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		if started {
+			// Headers are already sent; the truncated stream is the only signal left
+			zapLogger.Error("Profile export aborted", zap.Error(err))
+			return
+		}
+		zapLogger.Error("Failed to export profiles", zap.Error(err))
+		h.respondError(c, err)
+		return
+	}
+	if !started {
+		// Empty table: still answer with an (empty) NDJSON body
+		c.Header("Content-Type", ndjsonContentType)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+	}
+	zapLogger.Info("Profiles exported")
+}
+
+func derefOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -1,217 +1,444 @@
-package v1
-
-import (
-	"errors"
-	"net/http"
-
-	"github.com/duynhne/user-service/internal/core/domain"
-	logicv1 "github.com/duynhne/user-service/internal/logic/v1"
-	"github.com/duynhne/user-service/middleware"
-	"github.com/gin-gonic/gin"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/trace"
-	"go.uber.org/zap"
-)
-
-// UserHandler handles HTTP requests for user operations
-type UserHandler struct {
-	service *logicv1.UserService
-}
-
-// NewUserHandler creates a new user handler
-func NewUserHandler(service *logicv1.UserService) *UserHandler {
-	return &UserHandler{
-		service: service,
-	}
-}
-
-// GetUser handles HTTP request to get a user by ID
-func (h *UserHandler) GetUser(c *gin.Context) {
-	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
-		attribute.String("layer", "web"),
-		attribute.String("method", c.Request.Method),
-		attribute.String("path", c.Request.URL.Path),
-	))
-	defer span.End()
-
-	loggerVal, exists := c.Get("logger")
-	var zapLogger *zap.Logger
-	if exists {
-		if l, ok := loggerVal.(*zap.Logger); ok {
-			zapLogger = l
-		}
-	}
-	if zapLogger == nil {
-		zapLogger, _ = middleware.NewLogger()
-	}
-
-	id := c.Param("id")
-	span.SetAttributes(attribute.String("user.id", id))
-
-	user, err := h.service.GetUser(ctx, id)
-	if err != nil {
-		span.RecordError(err)
-		zapLogger.Error("Failed to get user", zap.Error(err))
-
-		switch {
-		case errors.Is(err, domain.ErrUserNotFound):
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		}
-		return
-	}
-
-	zapLogger.Info("User retrieved", zap.String("user_id", id))
-	c.JSON(http.StatusOK, user)
-}
-
-// GetProfile handles HTTP request to get current user profile
-func (h *UserHandler) GetProfile(c *gin.Context) {
-	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
-		attribute.String("layer", "web"),
-		attribute.String("method", c.Request.Method),
-		attribute.String("path", c.Request.URL.Path),
-	))
-	defer span.End()
-
-	loggerVal, exists := c.Get("logger")
-	var zapLogger *zap.Logger
-	if exists {
-		if l, ok := loggerVal.(*zap.Logger); ok {
-			zapLogger = l
-		}
-	}
-	if zapLogger == nil {
-		zapLogger, _ = middleware.NewLogger()
-	}
-
-	// Extract user info from auth middleware context (required - no fallback)
-	userID := c.GetString("user_id")
-	if userID == "" {
-		zapLogger.Warn("GetProfile: no user_id in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
-	username := c.GetString("username")
-	email := c.GetString("email")
-
-	user, err := h.service.GetProfile(ctx, userID, username, email)
-	if err != nil {
-		span.RecordError(err)
-		zapLogger.Error("Failed to get profile", zap.Error(err))
-
-		switch {
-		case errors.Is(err, domain.ErrUnauthorized):
-			c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized access"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		}
-		return
-	}
-
-	zapLogger.Info("Profile retrieved")
-	c.JSON(http.StatusOK, user)
-}
-
-// CreateUser handles HTTP request to create a new user
-func (h *UserHandler) CreateUser(c *gin.Context) {
-	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
-		attribute.String("layer", "web"),
-		attribute.String("method", c.Request.Method),
-		attribute.String("path", c.Request.URL.Path),
-	))
-	defer span.End()
-
-	loggerVal, exists := c.Get("logger")
-	var zapLogger *zap.Logger
-	if exists {
-		if l, ok := loggerVal.(*zap.Logger); ok {
-			zapLogger = l
-		}
-	}
-	if zapLogger == nil {
-		zapLogger, _ = middleware.NewLogger()
-	}
-
-	var req domain.CreateUserRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		span.SetAttributes(attribute.Bool("request.valid", false))
-		span.RecordError(err)
-		zapLogger.Error("Invalid request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": sanitizeValidationError(err)})
-		return
-	}
-
-	span.SetAttributes(attribute.Bool("request.valid", true))
-
-	user, err := h.service.CreateUser(ctx, req)
-	if err != nil {
-		span.RecordError(err)
-		zapLogger.Error("Failed to create user", zap.Error(err))
-
-		switch {
-		case errors.Is(err, domain.ErrUserExists):
-			c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
-		case errors.Is(err, domain.ErrInvalidEmail):
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		}
-		return
-	}
-
-	zapLogger.Info("User created", zap.String("user_id", user.ID))
-	c.JSON(http.StatusCreated, user)
-}
-
-// UpdateProfile handles PUT /api/v1/users/profile
-func (h *UserHandler) UpdateProfile(c *gin.Context) {
-	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
-		attribute.String("layer", "web"),
-		attribute.String("method", c.Request.Method),
-		attribute.String("path", c.Request.URL.Path),
-	))
-	defer span.End()
-
-	loggerVal, exists := c.Get("logger")
-	var zapLogger *zap.Logger
-	if exists {
-		if l, ok := loggerVal.(*zap.Logger); ok {
-			zapLogger = l
-		}
-	}
-	if zapLogger == nil {
-		zapLogger, _ = middleware.NewLogger()
-	}
-
-	// Get user_id from auth middleware (required - no fallback)
-	userID := c.GetString("user_id")
-	if userID == "" {
-		zapLogger.Warn("UpdateProfile: no user_id in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
-
-	var req domain.UpdateProfileRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		span.SetAttributes(attribute.Bool("request.valid", false))
-		span.RecordError(err)
-		zapLogger.Error("Invalid request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": sanitizeValidationError(err)})
-		return
-	}
-
-	span.SetAttributes(attribute.Bool("request.valid", true))
-
-	user, err := h.service.UpdateProfile(ctx, userID, req)
-	if err != nil {
-		span.RecordError(err)
-		zapLogger.Error("Failed to update profile", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	zapLogger.Info("Profile updated", zap.String("user_id", userID))
-	c.JSON(http.StatusOK, user)
-}
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duynhne/user-service/internal/core/domain"
+	logicv1 "github.com/duynhne/user-service/internal/logic/v1"
+	"github.com/duynhne/user-service/middleware"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// HandlerOptions tunes HTTP-level behavior of UserHandler; zero values select defaults
+type HandlerOptions struct {
+	// ProfileCacheMaxAge is the Cache-Control max-age for successful GetUser/GetProfile
+	// responses. Zero disables caching (no-store).
+	ProfileCacheMaxAge time.Duration
+	// MaxJSONDepth caps object/array nesting in request bodies (0 = DefaultMaxJSONDepth).
+	MaxJSONDepth int
+	// MaxBodyBytes caps the size of JSON request bodies (0 = DefaultMaxBodyBytes).
+	MaxBodyBytes int64
+	// TrustedProxies controls which X-Forwarded-* headers are honored when
+	// building the Location header (nil = never trust forwarded headers).
+	TrustedProxies *middleware.TrustedProxies
+	// AllowPublicSignup registers POST /api/v1/users without auth (ALLOW_PUBLIC_SIGNUP).
+	// Off by default so public creation is an explicit decision.
+	AllowPublicSignup bool
+	// PublicUserFields are the User fields returned to callers other than the user
+	// themself (e.g. public GetUser). Empty selects DefaultPublicUserFields.
+	PublicUserFields []string
+	// RoutePrefix is the group prefix the routes are mounted under (ROUTE_PREFIX),
+	// used when building absolute paths such as the Location header.
+	RoutePrefix string
+	// StrictQueryParams rejects query parameters a route does not declare
+	// (STRICT_QUERY_PARAMS); see RouteSpec.QueryParams.
+	StrictQueryParams bool
+	// ListMaxLimit is the largest `limit` list endpoints accept (0 = DefaultListMaxLimit).
+	ListMaxLimit int
+	// UpdateRequiresProfile makes UpdateProfile answer 404 instead of creating a
+	// missing profile (UPDATE_PROFILE_CREATE=false); ?create overrides it per request.
+	UpdateRequiresProfile bool
+	// ErrorDetail adds a sanitized "detail" field to error responses (see errorDetail).
+	// Enabled in development only; production clients get the generic message.
+	ErrorDetail bool
+}
+
+// DefaultPublicUserFields are the non-PII User fields visible to anonymous callers
+var DefaultPublicUserFields = []string{"id", "username", "name"}
+
+// UserHandler handles HTTP requests for user operations
+type UserHandler struct {
+	service *logicv1.UserService
+	opts    HandlerOptions
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(service *logicv1.UserService, opts HandlerOptions) *UserHandler {
+	return &UserHandler{
+		service: service,
+		opts:    opts,
+	}
+}
+
+// setReadCacheHeaders marks a successful profile read as privately cacheable
+func (h *UserHandler) setReadCacheHeaders(c *gin.Context) {
+	maxAge := int(h.opts.ProfileCacheMaxAge.Seconds())
+	if maxAge <= 0 {
+		c.Header("Cache-Control", "no-store")
+		return
+	}
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(maxAge))
+}
+
+// projectUser applies field-level visibility: the authenticated owner sees the
+// full user, everyone else only PublicUserFields (no email/phone/address by default).
+// Fields are selected by their JSON name, so every domain.User field can be listed;
+// empty omitempty fields stay absent.
+func (h *UserHandler) projectUser(c *gin.Context, user *domain.User) (any, error) {
+	if callerID := c.GetString("user_id"); callerID != "" && callerID == user.ID.String() {
+		return user, nil
+	}
+	fields := h.opts.PublicUserFields
+	if len(fields) == 0 {
+		fields = DefaultPublicUserFields
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("encode user: %w", err)
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("project user fields: %w", err)
+	}
+	out := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			out[field] = value
+		}
+	}
+	return out, nil
+}
+
+// endRequestSpan sets the http.request span status from the final response code
+// and ends the span: 2xx/3xx are Ok, 5xx are Error, 4xx stay Unset (client errors
+// are not span failures per OTel HTTP semantic conventions).
+func endRequestSpan(c *gin.Context, span trace.Span) {
+	status := c.Writer.Status()
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	switch {
+	case status >= http.StatusInternalServerError:
+		span.SetStatus(codes.Error, http.StatusText(status))
+	case status < http.StatusBadRequest:
+		span.SetStatus(codes.Ok, "")
+	}
+	span.End()
+}
+
+// GetUser handles HTTP request to get a user by ID
+func (h *UserHandler) GetUser(c *gin.Context) {
+	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
+		attribute.String("layer", "web"),
+		attribute.String("method", c.Request.Method),
+		attribute.String("path", c.Request.URL.Path),
+	))
+	defer endRequestSpan(c, span)
+
+	loggerVal, exists := c.Get("logger")
+	var zapLogger *zap.Logger
+	if exists {
+		if l, ok := loggerVal.(*zap.Logger); ok {
+			zapLogger = l
+		}
+	}
+	if zapLogger == nil {
+		zapLogger, _ = middleware.NewLogger()
+	}
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("user.id", id))
+
+	user, err := h.service.GetUser(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		zapLogger.Error("Failed to get user", zap.Error(err))
+
+		h.respondError(c, err)
+		return
+	}
+
+	body, err := h.projectUser(c, user)
+	if err != nil {
+		span.RecordError(err)
+		zapLogger.Error("Failed to project user", zap.Error(err))
+		h.respondError(c, err)
+		return
+	}
+
+	zapLogger.Info("User retrieved", zap.String("user_id", id))
+	h.setReadCacheHeaders(c)
+	c.JSON(http.StatusOK, body)
+}
+
+// profileResponse is the current user plus whether a profile row is stored;
+// false means the fields were synthesized from auth data.
+type profileResponse struct {
+	*domain.User
+	ProfileExists bool `json:"profile_exists"`
+}
+
+// GetProfile handles HTTP request to get current user profile
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
+		attribute.String("layer", "web"),
+		attribute.String("method", c.Request.Method),
+		attribute.String("path", c.Request.URL.Path),
+	))
+	defer endRequestSpan(c, span)
+
+	loggerVal, exists := c.Get("logger")
+	var zapLogger *zap.Logger
+	if exists {
+		if l, ok := loggerVal.(*zap.Logger); ok {
+			zapLogger = l
+		}
+	}
+	if zapLogger == nil {
+		zapLogger, _ = middleware.NewLogger()
+	}
+
+	// Extract user info from auth middleware context (required - no fallback)
+	userID := c.GetString("user_id")
+	if userID == "" {
+		zapLogger.Warn("GetProfile: no user_id in context")
+		writeError(c, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+		return
+	}
+	username := c.GetString("username")
+	email := c.GetString("email")
+
+	// ?strict=true returns 404 instead of synthesized auth data when no profile exists
+	strict := false
+	if v := c.Query("strict"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, codeInvalidRequest, "strict must be a boolean")
+			return
+		}
+		strict = parsed
+	}
+
+	user, profileExists, err := h.service.GetProfile(ctx, userID, username, email)
+	if err != nil {
+		span.RecordError(err)
+		zapLogger.Error("Failed to get profile", zap.Error(err))
+
+		h.respondError(c, err)
+		return
+	}
+	span.SetAttributes(attribute.Bool("profile.exists", profileExists))
+	if strict && !profileExists {
+		h.respondError(c, domain.ErrProfileNotFound)
+		return
+	}
+
+	zapLogger.Info("Profile retrieved", zap.Bool("profile_exists", profileExists))
+	h.setReadCacheHeaders(c)
+	if user.ETag != "" {
+		c.Header("ETag", user.ETag)
+	}
+	c.JSON(http.StatusOK, profileResponse{User: user, ProfileExists: profileExists})
+}
+
+// CreateUser handles HTTP request to create a new user
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
+		attribute.String("layer", "web"),
+		attribute.String("method", c.Request.Method),
+		attribute.String("path", c.Request.URL.Path),
+	))
+	defer endRequestSpan(c, span)
+
+	loggerVal, exists := c.Get("logger")
+	var zapLogger *zap.Logger
+	if exists {
+		if l, ok := loggerVal.(*zap.Logger); ok {
+			zapLogger = l
+		}
+	}
+	if zapLogger == nil {
+		zapLogger, _ = middleware.NewLogger()
+	}
+
+	var req domain.CreateUserRequest
+	if err := bindJSON(ctx, c, &req, h.opts.MaxJSONDepth, h.opts.MaxBodyBytes); err != nil {
+		span.SetAttributes(attribute.Bool("request.valid", false))
+		span.RecordError(err)
+		zapLogger.Error("Invalid request", zap.Error(err))
+		writeBindError(c, err)
+		return
+	}
+
+	// ?upsert=true returns an existing profile (200) instead of 409, for safe client retries
+	upsert := false
+	if v := c.Query("upsert"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, codeInvalidRequest, "upsert must be a boolean")
+			return
+		}
+		upsert = parsed
+	}
+
+	span.SetAttributes(attribute.Bool("request.valid", true))
+
+	user, created, err := h.service.CreateUser(ctx, req, upsert)
+	if err != nil {
+		span.RecordError(err)
+		zapLogger.Error("Failed to create user", zap.Error(err))
+
+		h.respondError(c, err)
+		return
+	}
+
+	location := h.opts.RoutePrefix + "/api/v1/users/" + user.ID.String()
+	c.Header("Location", h.opts.TrustedProxies.ExternalURL(c, location))
+	if !created {
+		zapLogger.Info("User already exists, returning existing profile",
+			zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusOK, user)
+		return
+	}
+	zapLogger.Info("User created", zap.String("user_id", user.ID.String()))
+	c.JSON(http.StatusCreated, user)
+}
+
+// updateProfileResponse is the updated user plus the fields whose stored value changed
+type updateProfileResponse struct {
+	*domain.User
+	UpdatedFields []string `json:"updated_fields"`
+}
+
+// UpdateProfile handles PUT /api/v1/users/profile
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
+		attribute.String("layer", "web"),
+		attribute.String("method", c.Request.Method),
+		attribute.String("path", c.Request.URL.Path),
+	))
+	defer endRequestSpan(c, span)
+
+	loggerVal, exists := c.Get("logger")
+	var zapLogger *zap.Logger
+	if exists {
+		if l, ok := loggerVal.(*zap.Logger); ok {
+			zapLogger = l
+		}
+	}
+	if zapLogger == nil {
+		zapLogger, _ = middleware.NewLogger()
+	}
+
+	// Get user_id from auth middleware (required - no fallback)
+	userID := c.GetString("user_id")
+	if userID == "" {
+		zapLogger.Warn("UpdateProfile: no user_id in context")
+		writeError(c, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+		return
+	}
+
+	var req domain.UpdateProfileRequest
+	if err := bindJSON(ctx, c, &req, h.opts.MaxJSONDepth, h.opts.MaxBodyBytes); err != nil {
+		span.SetAttributes(attribute.Bool("request.valid", false))
+		span.RecordError(err)
+		zapLogger.Error("Invalid request", zap.Error(err))
+		writeBindError(c, err)
+		return
+	}
+
+	span.SetAttributes(attribute.Bool("request.valid", true))
+
+	opts := logicv1.UpdateProfileOptions{RequireExisting: h.opts.UpdateRequiresProfile}
+
+	// Optional ?update_mask=name,phone restricts which fields are written
+	if mask := c.Query("update_mask"); mask != "" {
+		opts.UpdateMask = strings.Split(mask, ",")
+		span.SetAttributes(attribute.StringSlice("request.update_mask", opts.UpdateMask))
+	}
+
+	// ?create=false returns 404 instead of creating a missing profile (and
+	// ?create=true restores the upsert when UPDATE_PROFILE_CREATE=false)
+	if v := c.Query("create"); v != "" {
+		create, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, codeInvalidRequest, "create must be a boolean")
+			return
+		}
+		opts.RequireExisting = !create
+	}
+
+	// If-Match makes the update conditional on the profile ETag from GetProfile
+	opts.IfMatch = parseIfMatch(c.GetHeader("If-Match"))
+	if len(opts.IfMatch) > 0 {
+		span.SetAttributes(attribute.StringSlice("request.if_match", opts.IfMatch))
+	}
+
+	user, updatedFields, err := h.service.UpdateProfile(ctx, userID, req, opts)
+	if err != nil {
+		span.RecordError(err)
+		zapLogger.Error("Failed to update profile", zap.Error(err))
+		h.respondError(c, err)
+		return
+	}
+
+	zapLogger.Info("Profile updated",
+		zap.String("user_id", userID),
+		zap.Strings("updated_fields", updatedFields),
+	)
+	c.Header("ETag", user.ETag)
+	c.JSON(http.StatusOK, updateProfileResponse{User: user, UpdatedFields: updatedFields})
+}
+
+// parseIfMatch splits an If-Match header into its entity tags ("*" included
+// as-is); nil when the header is absent.
+func parseIfMatch(header string) []string {
+	var tags []string
+	for tag := range strings.SplitSeq(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// CountUsers handles GET /admin/users/count
+// ?approx=true returns a fast planner estimate instead of an exact count.
+func (h *UserHandler) CountUsers(c *gin.Context) {
+	ctx, span := middleware.StartSpan(c.Request.Context(), "http.request", trace.WithAttributes(
+		attribute.String("layer", "web"),
+		attribute.String("method", c.Request.Method),
+		attribute.String("path", c.Request.URL.Path),
+	))
+	defer endRequestSpan(c, span)
+
+	loggerVal, exists := c.Get("logger")
+	var zapLogger *zap.Logger
+	if exists {
+		if l, ok := loggerVal.(*zap.Logger); ok {
+			zapLogger = l
+		}
+	}
+	if zapLogger == nil {
+		zapLogger, _ = middleware.NewLogger()
+	}
+
+	approx := false
+	if v := c.Query("approx"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, codeInvalidRequest, "approx must be a boolean")
+			return
+		}
+		approx = parsed
+	}
+
+	total, err := h.service.CountProfiles(ctx, approx)
+	if err != nil {
+		span.RecordError(err)
+		zapLogger.Error("Failed to count users", zap.Error(err))
+		h.respondError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"total": total})
+}
@@ -0,0 +1,1029 @@
+package v1_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	database "github.com/duynhne/user-service/internal/core"
+	"github.com/duynhne/user-service/internal/core/domain"
+	logicv1 "github.com/duynhne/user-service/internal/logic/v1"
+	webv1 "github.com/duynhne/user-service/internal/web/v1"
+	"github.com/duynhne/user-service/middleware"
+)
+
+// memoryRepository is an in-memory domain.UserRepository used by handler tests.
+type memoryRepository struct {
+	mu       sync.Mutex
+	nextID   int
+	profiles map[int]*domain.UserProfile
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		nextID:   1,
+		profiles: make(map[int]*domain.UserProfile),
+	}
+}
+
+func (r *memoryRepository) GetUser(_ context.Context, id string) (*domain.User, error) {
+	if id == "999" {
+		return nil, domain.ErrUserNotFound
+	}
+	return &domain.User{
+		ID:       domain.ID(id),
+		Username: "user" + id,
+		Email:    "user" + id + "@example.com",
+		Name:     "User " + id,
+	}, nil
+}
+
+func (r *memoryRepository) GetProfileByUserID(_ context.Context, userID int) (*domain.UserProfile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.profiles[userID], nil
+}
+
+func (r *memoryRepository) CreateUserProfile(
+	_ context.Context, userID int, name domain.ProfileName,
+) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.nextID
+	r.nextID++
+	now := time.Now()
+	r.profiles[userID] = &domain.UserProfile{ID: id, UserID: userID, CreatedAt: &now, UpdatedAt: &now}
+	setProfileName(r.profiles[userID], name)
+	return id, nil
+}
+
+func (r *memoryRepository) CreateUserProfileIfAbsent(
+	ctx context.Context, userID int, name domain.ProfileName,
+) (int, bool, error) {
+	r.mu.Lock()
+	_, exists := r.profiles[userID]
+	r.mu.Unlock()
+	if exists {
+		return 0, false, nil
+	}
+	id, err := r.CreateUserProfile(ctx, userID, name)
+	return id, err == nil, err
+}
+
+func (r *memoryRepository) UpdateUserProfile(
+	_ context.Context, userID int, name domain.ProfileName, phone string,
+) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	profile, ok := r.profiles[userID]
+	if !ok {
+		return false, nil
+	}
+	setProfileName(profile, name)
+	profile.Phone = &phone
+	now := time.Now()
+	profile.UpdatedAt = &now
+	return true, nil
+}
+
+// setProfileName stores name like the SQL repository: an empty display name is NULL
+func setProfileName(profile *domain.UserProfile, name domain.ProfileName) {
+	profile.FirstName = &name.First
+	profile.LastName = &name.Last
+	profile.DisplayName = nil
+	if name.Display != "" {
+		profile.DisplayName = &name.Display
+	}
+}
+
+func (r *memoryRepository) CountProfiles(_ context.Context, userID int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.profiles[userID]; ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (r *memoryRepository) CountAllProfiles(_ context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.profiles), nil
+}
+
+func (r *memoryRepository) EstimateProfileCount(ctx context.Context) (int, error) {
+	return r.CountAllProfiles(ctx)
+}
+
+func (r *memoryRepository) StreamProfiles(
+	ctx context.Context, opts domain.ProfileListOptions, fn func(*domain.UserProfile) error,
+) error {
+	sort := opts.Sort
+	r.mu.Lock()
+	profiles := make([]domain.UserProfile, 0, len(r.profiles))
+	for _, p := range r.profiles {
+		profiles = append(profiles, *p)
+	}
+	r.mu.Unlock()
+
+	// created_at is not tracked in memory; it sorts like user_id (insertion order)
+	slices.SortFunc(profiles, func(a, b domain.UserProfile) int {
+		cmp := a.UserID - b.UserID
+		if sort.Field == domain.SortByName {
+			nameA, nameB := *a.FirstName+" "+*a.LastName, *b.FirstName+" "+*b.LastName
+			if byName := strings.Compare(nameA, nameB); byName != 0 {
+				cmp = byName
+			}
+		}
+		if sort.Desc {
+			return -cmp
+		}
+		return cmp
+	})
+	if opts.Limit > 0 && len(profiles) > opts.Limit {
+		profiles = profiles[:opts.Limit]
+	}
+	for i := range profiles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&profiles[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) UpsertUserProfile(
+	ctx context.Context, userID int, name domain.ProfileName, phone string,
+) error {
+	updated, err := r.UpdateUserProfile(ctx, userID, name, phone)
+	if err != nil || updated {
+		return err
+	}
+	if _, err := r.CreateUserProfile(ctx, userID, name); err != nil {
+		return err
+	}
+	_, err = r.UpdateUserProfile(ctx, userID, name, phone)
+	return err
+}
+
+func (r *memoryRepository) UpdateProfileLocked(
+	ctx context.Context, userID int, apply domain.ProfileUpdateFunc,
+) (time.Time, error) {
+	r.mu.Lock()
+	var current *domain.UserProfile
+	if p, ok := r.profiles[userID]; ok {
+		cp := *p
+		current = &cp
+	}
+	r.mu.Unlock()
+
+	name, phone, err := apply(current)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := r.UpsertUserProfile(ctx, userID, name, phone); err != nil {
+		return time.Time{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.profiles[userID].UpdatedAt, nil
+}
+
+// testUserHeader carries the authenticated user id for fakeAuth.
+const testUserHeader = "X-Test-User-ID"
+
+// testRolesHeader carries comma-separated roles for fakeAuth.
+const testRolesHeader = "X-Test-Roles"
+
+// fakeAuth mimics middleware.AuthMiddleware without calling the auth service:
+// it copies the user id (testUserHeader) and roles (testRolesHeader) into the
+// gin context when present.
+func fakeAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID := c.GetHeader(testUserHeader); userID != "" {
+			c.Set("user_id", userID)
+			c.Set("username", "alice")
+			c.Set("email", "alice@example.com")
+			if roles := c.GetHeader(testRolesHeader); roles != "" {
+				c.Set("roles", strings.Split(roles, ","))
+			}
+		}
+		c.Next()
+	}
+}
+
+func newTestRouter(repo domain.UserRepository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := webv1.NewUserHandler(logicv1.NewUserService(repo, logicv1.ServiceOptions{}), webv1.HandlerOptions{})
+
+	r := gin.New()
+	if err := webv1.RegisterRoutes(r, handler.Routes(), fakeAuth()); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func doRequest(t *testing.T, r http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, path, http.NoBody)
+	} else {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v (body=%q)", err, w.Body.String())
+	}
+	return body
+}
+
+// assertError checks the status code and the {"error": "<message>"} envelope.
+func assertError(t *testing.T, w *httptest.ResponseRecorder, wantStatus int) {
+	t.Helper()
+	if w.Code != wantStatus {
+		t.Fatalf("status = %d, want %d (body=%s)", w.Code, wantStatus, w.Body.String())
+	}
+	body := decodeBody(t, w)
+	msg, ok := body["error"].(string)
+	if !ok || msg == "" {
+		t.Fatalf("expected non-empty string field \"error\", got %v", body)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	r := newTestRouter(newMemoryRepository())
+
+	t.Run("success", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/42", "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		body := decodeBody(t, w)
+		if body["id"] != "42" {
+			t.Errorf("id = %v, want 42", body["id"])
+		}
+		if _, ok := body["email"]; ok {
+			t.Errorf("public GetUser leaked email: %v", body)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/999", "", nil)
+		assertError(t, w, http.StatusNotFound)
+	})
+}
+
+func TestGetUserPublicFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := logicv1.NewUserService(newMemoryRepository(), logicv1.ServiceOptions{})
+	handler := webv1.NewUserHandler(service, webv1.HandlerOptions{
+		PublicUserFields: []string{"id", "email"},
+	})
+	r := gin.New()
+	if err := webv1.RegisterRoutes(r, handler.Routes(), fakeAuth()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doRequest(t, r, http.MethodGet, "/api/v1/users/42", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	keys := slices.Sorted(maps.Keys(decodeBody(t, w)))
+	if want := []string{"email", "id"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("fields = %v, want %v", keys, want)
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	repo := newMemoryRepository()
+	r := newTestRouter(repo)
+
+	t.Run("success", func(t *testing.T) {
+		alice := domain.ProfileName{First: "Alice", Last: "Johnson"}
+		if _, err := repo.CreateUserProfile(context.Background(), 7, alice); err != nil {
+			t.Fatal(err)
+		}
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile", "", map[string]string{testUserHeader: "7"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		body := decodeBody(t, w)
+		if body["name"] != "Alice Johnson" {
+			t.Errorf("name = %v, want %q", body["name"], "Alice Johnson")
+		}
+		if body["profile_exists"] != true {
+			t.Errorf("profile_exists = %v, want true", body["profile_exists"])
+		}
+	})
+
+	t.Run("address round-trips", func(t *testing.T) {
+		address := "123 Main St, San Francisco, CA 94102"
+		repo.mu.Lock()
+		repo.profiles[9] = &domain.UserProfile{ID: 9, UserID: 9, Address: &address}
+		repo.mu.Unlock()
+
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile", "", map[string]string{testUserHeader: "9"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if body := decodeBody(t, w); body["address"] != address {
+			t.Errorf("address = %v, want %q", body["address"], address)
+		}
+	})
+
+	t.Run("no profile", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile", "", map[string]string{testUserHeader: "8"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		body := decodeBody(t, w)
+		if body["profile_exists"] != false {
+			t.Errorf("profile_exists = %v, want false", body["profile_exists"])
+		}
+	})
+
+	t.Run("no profile strict", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile?strict=true", "",
+			map[string]string{testUserHeader: "8"})
+		assertError(t, w, http.StatusNotFound)
+	})
+
+	t.Run("missing user_id", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile", "", nil)
+		assertError(t, w, http.StatusUnauthorized)
+	})
+}
+
+// unavailableRepository fails profile reads as if the pool were never connected.
+type unavailableRepository struct {
+	*memoryRepository
+}
+
+func (unavailableRepository) GetProfileByUserID(context.Context, int) (*domain.UserProfile, error) {
+	return nil, database.ErrPoolUnavailable
+}
+
+func TestGetProfilePoolUnavailable(t *testing.T) {
+	r := newTestRouter(unavailableRepository{newMemoryRepository()})
+
+	w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile", "",
+		map[string]string{testUserHeader: "1"})
+	assertError(t, w, http.StatusServiceUnavailable)
+	if code := decodeBody(t, w)["code"]; code != "database_unavailable" {
+		t.Errorf("code = %v, want database_unavailable", code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+}
+
+// failingRepository fails profile reads with err.
+type failingRepository struct {
+	*memoryRepository
+	err error
+}
+
+func (r failingRepository) GetProfileByUserID(context.Context, int) (*domain.UserProfile, error) {
+	return nil, r.err
+}
+
+func TestErrorDetail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		err        error
+		detail     bool // HandlerOptions.ErrorDetail
+		wantDetail string
+	}{
+		{name: "production hides detail", err: errors.New("boom")},
+		{
+			name:       "plain error",
+			err:        errors.New("boom"),
+			detail:     true,
+			wantDetail: "query user profile: boom",
+		},
+		{
+			name: "redacted error keeps only its detail",
+			err: &domain.RedactedError{
+				Detail: "database error (SQLSTATE 42P01)",
+				Err:    errors.New(`relation "user_profiles" does not exist`),
+			},
+			detail:     true,
+			wantDetail: "database error (SQLSTATE 42P01)",
+		},
+		{
+			name:       "SQL is cut off",
+			err:        errors.New("scan failed: SELECT name FROM user_profiles WHERE user_id = 1"),
+			detail:     true,
+			wantDetail: "query user profile: scan failed: <sql>",
+		},
+		{
+			name:       "paths are redacted",
+			err:        errors.New("open /app/internal/core/database.go: no such file"),
+			detail:     true,
+			wantDetail: "query user profile: open <path>: no such file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := failingRepository{memoryRepository: newMemoryRepository(), err: tt.err}
+			service := logicv1.NewUserService(repo, logicv1.ServiceOptions{})
+			handler := webv1.NewUserHandler(service, webv1.HandlerOptions{ErrorDetail: tt.detail})
+			r := gin.New()
+			if err := webv1.RegisterRoutes(r, handler.Routes(), fakeAuth()); err != nil {
+				t.Fatal(err)
+			}
+
+			w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile", "",
+				map[string]string{testUserHeader: "1"})
+			assertError(t, w, http.StatusInternalServerError)
+			body := decodeBody(t, w)
+			if body["error"] != "Internal server error" {
+				t.Errorf("error = %v, want the generic message", body["error"])
+			}
+			detail, _ := body["detail"].(string)
+			if detail != tt.wantDetail {
+				t.Errorf("detail = %q, want %q", detail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	r := newTestRouter(newMemoryRepository())
+
+	t.Run("success", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users",
+			`{"username":"alice","email":"alice@example.com","name":"Alice Johnson"}`, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusCreated, w.Body.String())
+		}
+		body := decodeBody(t, w)
+		if body["username"] != "alice" {
+			t.Errorf("username = %v, want alice", body["username"])
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users",
+			`{"username":"alice","email":"alice@example.com","name":"Alice Johnson"}`, nil)
+		assertError(t, w, http.StatusConflict)
+	})
+
+	t.Run("upsert returns existing", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users?upsert=true",
+			`{"username":"alice","email":"alice@example.com","name":"Someone Else"}`, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		body := decodeBody(t, w)
+		if body["name"] != "Alice Johnson" {
+			t.Errorf("name = %v, want stored %q", body["name"], "Alice Johnson")
+		}
+	})
+
+	t.Run("upsert creates", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users?upsert=true",
+			`{"username":"christopher","email":"chris@example.com","name":"Chris"}`, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusCreated, w.Body.String())
+		}
+	})
+
+	t.Run("invalid upsert", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users?upsert=maybe",
+			`{"username":"dave","email":"dave@example.com","name":"Dave"}`, nil)
+		assertError(t, w, http.StatusBadRequest)
+	})
+
+	t.Run("privileged fields ignored", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users",
+			`{"username":"mallory","email":"mallory@example.com","name":"Mallory",`+
+				`"id":"1","roles":["admin"],"verified":true}`, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusCreated, w.Body.String())
+		}
+		body := decodeBody(t, w)
+		if body["id"] == "1" {
+			t.Errorf("client-supplied id was assigned: %v", body)
+		}
+		for _, field := range []string{"roles", "verified"} {
+			if _, ok := body[field]; ok {
+				t.Errorf("privileged field %q leaked into response: %v", field, body)
+			}
+		}
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users", `{"username":`, nil)
+		assertError(t, w, http.StatusBadRequest)
+	})
+
+	t.Run("missing required field", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users", `{"username":"bob"}`, nil)
+		assertError(t, w, http.StatusBadRequest)
+	})
+
+	blankNames := []struct {
+		name string
+		body string
+	}{
+		{name: "whitespace-only name", body: `{"username":"blank","email":"blank@example.com","name":"   "}`},
+		{
+			name: "empty after trim",
+			body: `{"username":"blank","email":"blank@example.com","name":" \t\n "}`,
+		},
+	}
+	for _, tt := range blankNames {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(t, r, http.MethodPost, "/api/v1/users", tt.body, nil)
+			assertError(t, w, http.StatusBadRequest)
+			if code := decodeBody(t, w)["code"]; code != "invalid_name" {
+				t.Errorf("code = %v, want invalid_name", code)
+			}
+		})
+	}
+
+	t.Run("body too large", func(t *testing.T) {
+		padding := strings.Repeat("a", webv1.DefaultMaxBodyBytes)
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users",
+			`{"username":"big","email":"big@example.com","name":"Big","x":"`+padding+`"}`, nil)
+		assertError(t, w, http.StatusRequestEntityTooLarge)
+		if code := decodeBody(t, w)["code"]; code != "request_too_large" {
+			t.Errorf("code = %v, want request_too_large", code)
+		}
+	})
+
+	t.Run("nesting too deep", func(t *testing.T) {
+		nested := strings.Repeat(`{"a":`, webv1.DefaultMaxJSONDepth) + `1` + strings.Repeat(`}`, webv1.DefaultMaxJSONDepth)
+		w := doRequest(t, r, http.MethodPost, "/api/v1/users",
+			`{"username":"deep","email":"deep@example.com","name":"Deep","x":`+nested+`}`, nil)
+		assertError(t, w, http.StatusBadRequest)
+	})
+}
+
+// TestCreateUserRequiresAuth checks POST /api/v1/users behind the real auth
+// middleware with the unauthenticated fallback disabled.
+func TestCreateUserRequiresAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// No Authorization header means the auth service is never called
+	auth := middleware.AuthMiddleware(middleware.NewAuthClient("http://127.0.0.1:0", middleware.AuthClientOptions{}),
+		zap.NewNop(), false, nil)
+	const body = `{"username":"alice","email":"alice@example.com","name":"Alice Johnson"}`
+
+	newRouter := func(opts webv1.HandlerOptions) *gin.Engine {
+		handler := webv1.NewUserHandler(logicv1.NewUserService(newMemoryRepository(), logicv1.ServiceOptions{}), opts)
+		r := gin.New()
+		if err := webv1.RegisterRoutes(r, handler.Routes(), auth); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		w := doRequest(t, newRouter(webv1.HandlerOptions{}), http.MethodPost, "/api/v1/users", body, nil)
+		assertError(t, w, http.StatusUnauthorized)
+	})
+
+	t.Run("public signup allowed", func(t *testing.T) {
+		w := doRequest(t, newRouter(webv1.HandlerOptions{AllowPublicSignup: true}),
+			http.MethodPost, "/api/v1/users", body, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusCreated, w.Body.String())
+		}
+	})
+}
+
+func TestUpdateProfile(t *testing.T) {
+	r := newTestRouter(newMemoryRepository())
+
+	t.Run("success", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPut, "/api/v1/users/profile",
+			`{"name":"Bob Smith","phone":"+1-555-0102"}`, map[string]string{testUserHeader: "2"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		body := decodeBody(t, w)
+		if body["id"] != "2" || body["name"] != "Bob Smith" {
+			t.Errorf("unexpected body %v", body)
+		}
+		if want := []any{"name", "phone"}; !reflect.DeepEqual(body["updated_fields"], want) {
+			t.Errorf("updated_fields = %v, want %v", body["updated_fields"], want)
+		}
+	})
+
+	// Tri-state optional fields: omitted = unchanged, null = clear, "" = clear
+	triState := []struct {
+		name        string
+		body        string
+		wantPhone   any // nil when phone must be absent (cleared)
+		wantUpdated []any
+	}{
+		{name: "omitted phone unchanged", body: `{"name":"Bob Smith"}`, wantPhone: "+1-555-0102", wantUpdated: []any{}},
+		{name: "null phone cleared", body: `{"phone":null}`, wantPhone: nil, wantUpdated: []any{"phone"}},
+		{name: "empty phone cleared", body: `{"phone":""}`, wantPhone: nil, wantUpdated: []any{"phone"}},
+	}
+	for _, tt := range triState {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{testUserHeader: "3"}
+			seed := doRequest(t, r, http.MethodPut, "/api/v1/users/profile",
+				`{"name":"Bob Smith","phone":"+1-555-0102"}`, headers)
+			if seed.Code != http.StatusOK {
+				t.Fatalf("seed status = %d (body=%s)", seed.Code, seed.Body.String())
+			}
+
+			w := doRequest(t, r, http.MethodPut, "/api/v1/users/profile", tt.body, headers)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+			}
+			body := decodeBody(t, w)
+			if body["phone"] != tt.wantPhone {
+				t.Errorf("phone = %v, want %v", body["phone"], tt.wantPhone)
+			}
+			if body["name"] != "Bob Smith" {
+				t.Errorf("name = %v, want unchanged %q", body["name"], "Bob Smith")
+			}
+			if !reflect.DeepEqual(body["updated_fields"], tt.wantUpdated) {
+				t.Errorf("updated_fields = %v, want %v", body["updated_fields"], tt.wantUpdated)
+			}
+		})
+	}
+
+	t.Run("bad json", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPut, "/api/v1/users/profile", `{"name":`,
+			map[string]string{testUserHeader: "2"})
+		assertError(t, w, http.StatusBadRequest)
+	})
+
+	t.Run("missing user_id", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodPut, "/api/v1/users/profile", `{"name":"Bob"}`, nil)
+		assertError(t, w, http.StatusUnauthorized)
+	})
+}
+
+func TestUpdateProfileIfMatch(t *testing.T) {
+	r := newTestRouter(newMemoryRepository())
+	headers := map[string]string{testUserHeader: "4"}
+	const path = "/api/v1/users/profile"
+
+	withIfMatch := func(tag string) map[string]string {
+		return map[string]string{testUserHeader: "4", "If-Match": tag}
+	}
+
+	w := doRequest(t, r, http.MethodPut, path, `{"name":"Bob"}`, withIfMatch("*"))
+	assertError(t, w, http.StatusPreconditionFailed)
+
+	w = doRequest(t, r, http.MethodPut, path, `{"name":"Bob"}`, headers)
+	created := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || created == "" {
+		t.Fatalf("status = %d, ETag = %q (body=%s)", w.Code, created, w.Body.String())
+	}
+	w = doRequest(t, r, http.MethodGet, path, "", headers)
+	if etag := w.Header().Get("ETag"); etag != created {
+		t.Fatalf("GetProfile ETag = %q, want %q", etag, created)
+	}
+
+	w = doRequest(t, r, http.MethodPut, path, `{"name":"Carol"}`, withIfMatch(`"stale", `+created))
+	updated := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || updated == "" || updated == created {
+		t.Fatalf("status = %d, ETag = %q, want a new tag (body=%s)", w.Code, updated, w.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		ifMatch    string
+		wantStatus int
+	}{
+		{name: "stale tag", ifMatch: created, wantStatus: http.StatusPreconditionFailed},
+		{name: "weak tag", ifMatch: "W/" + updated, wantStatus: http.StatusPreconditionFailed},
+		{name: "any", ifMatch: "*", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(t, r, http.MethodPut, path, `{"name":"Dave"}`, withIfMatch(tt.ifMatch))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body=%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusPreconditionFailed {
+				if code := decodeBody(t, w)["code"]; code != "precondition_failed" {
+					t.Errorf("code = %v, want precondition_failed", code)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateProfileCreate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const path = "/api/v1/users/profile"
+
+	tests := []struct {
+		name            string
+		requireExisting bool // HandlerOptions.UpdateRequiresProfile (UPDATE_PROFILE_CREATE=false)
+		query           string
+		wantMissing     int // status when the user has no profile yet
+	}{
+		{name: "default upserts", wantMissing: http.StatusOK},
+		{name: "create=false", query: "?create=false", wantMissing: http.StatusNotFound},
+		{name: "config requires profile", requireExisting: true, wantMissing: http.StatusNotFound},
+		{name: "create=true overrides config", requireExisting: true, query: "?create=true",
+			wantMissing: http.StatusOK},
+		{name: "invalid", query: "?create=maybe", wantMissing: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository()
+			service := logicv1.NewUserService(repo, logicv1.ServiceOptions{})
+			handler := webv1.NewUserHandler(service, webv1.HandlerOptions{
+				UpdateRequiresProfile: tt.requireExisting,
+			})
+			r := gin.New()
+			if err := webv1.RegisterRoutes(r, handler.Routes(), fakeAuth()); err != nil {
+				t.Fatal(err)
+			}
+
+			w := doRequest(t, r, http.MethodPut, path+tt.query, `{"name":"Bob"}`,
+				map[string]string{testUserHeader: "6"})
+			if w.Code != tt.wantMissing {
+				t.Fatalf("missing profile: status = %d, want %d (body=%s)",
+					w.Code, tt.wantMissing, w.Body.String())
+			}
+			if w.Code == http.StatusNotFound {
+				if code := decodeBody(t, w)["code"]; code != "profile_not_found" {
+					t.Errorf("code = %v, want profile_not_found", code)
+				}
+				if n, _ := repo.CountProfiles(context.Background(), 6); n > 0 {
+					t.Error("profile was created despite create=false")
+				}
+			}
+
+			// An existing profile is always updated
+			if _, err := repo.CreateUserProfile(context.Background(), 7,
+				domain.ProfileName{First: "Old"}); err != nil {
+				t.Fatal(err)
+			}
+			w = doRequest(t, r, http.MethodPut, path+tt.query, `{"name":"Carol"}`,
+				map[string]string{testUserHeader: "7"})
+			if tt.wantMissing != http.StatusBadRequest && w.Code != http.StatusOK {
+				t.Errorf("existing profile: status = %d, want %d (body=%s)",
+					w.Code, http.StatusOK, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUserOperationsMetric(t *testing.T) {
+	r := newTestRouter(newMemoryRepository())
+	headers := map[string]string{testUserHeader: "5"}
+
+	type outcome struct{ operation, outcome string }
+	steps := []struct {
+		name               string
+		method, path, body string
+		want               outcome
+	}{
+		{"create", http.MethodPost, "/api/v1/users",
+			`{"username":"metrics","email":"m@example.com","name":"M"}`,
+			outcome{"create_user", middleware.UserOutcomeCreated}},
+		{"lazy create", http.MethodPut, "/api/v1/users/profile", `{"name":"Eve"}`,
+			outcome{"update_profile", middleware.UserOutcomeAutoCreated}},
+		{"edit", http.MethodPut, "/api/v1/users/profile", `{"name":"Eve Smith"}`,
+			outcome{"update_profile", middleware.UserOutcomeUpdated}},
+	}
+	for _, step := range steps {
+		before := userOperationCount(t, step.want.operation, step.want.outcome)
+		w := doRequest(t, r, step.method, step.path, step.body, headers)
+		if w.Code >= 300 {
+			t.Fatalf("%s: status = %d (body=%s)", step.name, w.Code, w.Body.String())
+		}
+		if got := userOperationCount(t, step.want.operation, step.want.outcome); got != before+1 {
+			t.Errorf("%s: user_operations_total%v = %v, want %v", step.name, step.want, got, before+1)
+		}
+	}
+}
+
+// userOperationCount reads user_operations_total{operation,outcome} from the default registry
+func userOperationCount(t *testing.T, operation, outcome string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "user_operations_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["operation"] == operation && labels["outcome"] == outcome {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestNameStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const name = "Mary  Ann Smith" // double space is lost by the first/last split
+
+	tests := []struct {
+		storage  string
+		wantName string
+	}{
+		{storage: domain.NameStorageSplit, wantName: "Mary Ann Smith"},
+		{storage: domain.NameStorageDisplayName, wantName: name},
+	}
+	for _, tt := range tests {
+		t.Run(tt.storage, func(t *testing.T) {
+			service := logicv1.NewUserService(newMemoryRepository(), logicv1.ServiceOptions{
+				NameStorage:  tt.storage,
+				MaxNameParts: 3,
+			})
+			r := gin.New()
+			if err := webv1.RegisterRoutes(r, webv1.NewUserHandler(service, webv1.HandlerOptions{}).Routes(),
+				fakeAuth()); err != nil {
+				t.Fatal(err)
+			}
+			headers := map[string]string{testUserHeader: "3"}
+
+			w := doRequest(t, r, http.MethodPut, "/api/v1/users/profile", `{"name":"`+name+`"}`, headers)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+			}
+			w = doRequest(t, r, http.MethodGet, "/api/v1/users/profile", "", headers)
+			if body := decodeBody(t, w); body["name"] != tt.wantName {
+				t.Errorf("name = %q, want %q", body["name"], tt.wantName)
+			}
+
+			w = doRequest(t, r, http.MethodPut, "/api/v1/users/profile", `{"name":"A B C D"}`, headers)
+			assertError(t, w, http.StatusBadRequest)
+			if body := decodeBody(t, w); body["code"] != "name_too_many_parts" ||
+				body["error"] != "Name must have at most 3 words" {
+				t.Errorf("too many parts: body = %v", body)
+			}
+
+			// Words longer than their VARCHAR column are a 400, not a database error
+			long := strings.Repeat("a", domain.MaxFirstNameLength+1)
+			w = doRequest(t, r, http.MethodPut, "/api/v1/users/profile", `{"name":"`+long+` B"}`, headers)
+			assertError(t, w, http.StatusBadRequest)
+			if code := decodeBody(t, w)["code"]; code != "name_too_long" {
+				t.Errorf("too long: code = %v, want name_too_long", code)
+			}
+		})
+	}
+}
+
+func TestListUsersNDJSON(t *testing.T) {
+	repo := newMemoryRepository()
+	r := newTestRouter(repo)
+	for _, userID := range []int{2, 1} {
+		if _, err := repo.CreateUserProfile(context.Background(), userID,
+			domain.ProfileName{First: "User", Last: strconv.Itoa(userID)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin := map[string]string{testUserHeader: "1", testRolesHeader: "admin"}
+
+	t.Run("streams one line per profile", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users?format=ndjson", "", admin)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+		}
+		lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("got %d lines, want 2: %q", len(lines), w.Body.String())
+		}
+		var first map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+			t.Fatalf("line 0 is not JSON: %v", err)
+		}
+		if first["id"] != "1" || first["last_name"] != "1" {
+			t.Errorf("line 0 = %v, want user 1 first", first)
+		}
+	})
+
+	t.Run("sorted desc", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet,
+			"/api/v1/users?format=ndjson&sort=user_id&order=desc", "", admin)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		var first map[string]any
+		line, _, _ := strings.Cut(w.Body.String(), "\n")
+		if err := json.Unmarshal([]byte(line), &first); err != nil {
+			t.Fatalf("line 0 is not JSON: %v", err)
+		}
+		if first["id"] != "2" {
+			t.Errorf("first id = %v, want 2", first["id"])
+		}
+	})
+
+	t.Run("unknown sort field", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users?format=ndjson&sort=password", "", admin)
+		assertError(t, w, http.StatusBadRequest)
+	})
+
+	t.Run("unknown order", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users?format=ndjson&order=sideways", "", admin)
+		assertError(t, w, http.StatusBadRequest)
+	})
+
+	t.Run("format required", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users", "", admin)
+		assertError(t, w, http.StatusBadRequest)
+	})
+
+	t.Run("admin only", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users?format=ndjson", "", map[string]string{testUserHeader: "1"})
+		assertError(t, w, http.StatusForbidden)
+	})
+}
+
+func TestListUsersLimit(t *testing.T) {
+	repo := newMemoryRepository()
+	for userID := 1; userID <= 3; userID++ {
+		_, err := repo.CreateUserProfile(context.Background(), userID,
+			domain.ProfileName{First: "User", Last: strconv.Itoa(userID)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	gin.SetMode(gin.TestMode)
+	service := logicv1.NewUserService(repo, logicv1.ServiceOptions{})
+	handler := webv1.NewUserHandler(service, webv1.HandlerOptions{ListMaxLimit: 2})
+	r := gin.New()
+	if err := webv1.RegisterRoutes(r, handler.Routes(), fakeAuth()); err != nil {
+		t.Fatal(err)
+	}
+	admin := map[string]string{testUserHeader: "1", testRolesHeader: "admin"}
+
+	t.Run("exactly max", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users?format=ndjson&limit=2", "", admin)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if lines := strings.Count(w.Body.String(), "\n"); lines != 2 {
+			t.Errorf("got %d lines, want 2", lines)
+		}
+	})
+
+	t.Run("absent defaults to max", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users?format=ndjson", "", admin)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if lines := strings.Count(w.Body.String(), "\n"); lines != 2 {
+			t.Errorf("got %d lines, want 2 (LIST_MAX_LIMIT)", lines)
+		}
+	})
+
+	t.Run("over max", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users?format=ndjson&limit=3", "", admin)
+		assertError(t, w, http.StatusBadRequest)
+		if msg, _ := decodeBody(t, w)["error"].(string); !strings.Contains(msg, "2") {
+			t.Errorf("error = %q, want it to state the max (2)", msg)
+		}
+	})
+
+	t.Run("not a number", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users?format=ndjson&limit=all", "", admin)
+		assertError(t, w, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteSpec declares one API route and its security requirements.
+// All routes are registered from a RouteSpec table (see Routes) so auth
+// requirements are reviewable in one place and cannot be forgotten per route.
+type RouteSpec struct {
+	Method       string
+	Path         string
+	Handler      gin.HandlerFunc
+	AuthRequired bool     // wrap with the auth middleware
+	Roles        []string // caller must hold at least one of these roles (implies AuthRequired)
+	// QueryParams are the query parameters the handler reads; nil means undeclared.
+	QueryParams []string
+	// StrictQuery rejects (400) query parameters outside QueryParams (STRICT_QUERY_PARAMS).
+	// Ignored when QueryParams is nil.
+	StrictQuery bool
+}
+
+// Routes returns the route table served by UserHandler
+func (h *UserHandler) Routes() []RouteSpec {
+	specs := []RouteSpec{
+		{Method: http.MethodGet, Path: "/api/v1/users/:id", Handler: h.GetUser, QueryParams: []string{}},
+		{
+			Method: http.MethodGet, Path: "/api/v1/users/profile", Handler: h.GetProfile,
+			AuthRequired: true, QueryParams: []string{"strict"},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/v1/users/profile", Handler: h.UpdateProfile,
+			AuthRequired: true, QueryParams: []string{"update_mask", "create"},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v1/users", Handler: h.CreateUser,
+			AuthRequired: !h.opts.AllowPublicSignup, QueryParams: []string{"upsert"},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/users", Handler: h.ListUsers,
+			AuthRequired: true, Roles: []string{"admin"},
+			QueryParams: []string{"format", "sort", "order", "limit"},
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/users/count", Handler: h.CountUsers,
+			AuthRequired: true, Roles: []string{"admin"}, QueryParams: []string{"approx"},
+		},
+	}
+	for i := range specs {
+		specs[i].StrictQuery = h.opts.StrictQueryParams
+	}
+	return specs
+}
+
+// RegisterRoutes registers specs on r, prefixing auth-required routes with auth,
+// role-restricted routes with a role check and strict routes with a query check.
+func RegisterRoutes(r gin.IRoutes, specs []RouteSpec, auth gin.HandlerFunc) error {
+	for _, spec := range specs {
+		handlers := make([]gin.HandlerFunc, 0, 4)
+		if spec.StrictQuery && spec.QueryParams != nil {
+			handlers = append(handlers, allowQueryParams(spec.QueryParams))
+		}
+		if spec.AuthRequired || len(spec.Roles) > 0 {
+			if auth == nil {
+				return fmt.Errorf("route %s %s requires auth but no auth middleware was provided",
+					spec.Method, spec.Path)
+			}
+			handlers = append(handlers, auth)
+		}
+		if len(spec.Roles) > 0 {
+			handlers = append(handlers, requireRoles(spec.Roles))
+		}
+		if spec.Handler == nil {
+			return fmt.Errorf("route %s %s has no handler", spec.Method, spec.Path)
+		}
+		handlers = append(handlers, spec.Handler)
+		r.Handle(spec.Method, spec.Path, handlers...)
+	}
+	return nil
+}
+
+// requireRoles allows the request only if the authenticated caller holds one of roles
+// (set as "roles" by the auth middleware from the auth service response).
+func requireRoles(roles []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("user_id") == "" {
+			writeError(c, http.StatusUnauthorized, codeUnauthenticated, "Authentication required")
+			c.Abort()
+			return
+		}
+		granted := c.GetStringSlice("roles")
+		for _, role := range roles {
+			if slices.Contains(granted, role) {
+				c.Next()
+				return
+			}
+		}
+		writeError(c, http.StatusForbidden, codeForbidden, "Insufficient permissions")
+		c.Abort()
+	}
+}
+
+// allowQueryParams rejects requests carrying query parameters outside allowed,
+// surfacing client typos (e.g. ?limt=10) instead of silently ignoring them.
+func allowQueryParams(allowed []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for name := range c.Request.URL.Query() {
+			if !slices.Contains(allowed, name) {
+				writeError(c, http.StatusBadRequest, codeInvalidRequest,
+					fmt.Sprintf("Unknown query parameter %q", name))
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
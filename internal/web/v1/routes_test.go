@@ -0,0 +1,86 @@
+package v1_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	logicv1 "github.com/duynhne/user-service/internal/logic/v1"
+	webv1 "github.com/duynhne/user-service/internal/web/v1"
+)
+
+// TestMutatingRoutesRequireAuth guards the route table: any route that can
+// change state must be registered behind the auth middleware.
+func TestMutatingRoutesRequireAuth(t *testing.T) {
+	service := logicv1.NewUserService(newMemoryRepository(), logicv1.ServiceOptions{})
+	handler := webv1.NewUserHandler(service, webv1.HandlerOptions{})
+
+	for _, route := range handler.Routes() {
+		switch route.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			continue
+		}
+		if !route.AuthRequired {
+			t.Errorf("%s %s is a mutating route but does not require auth", route.Method, route.Path)
+		}
+	}
+}
+
+func TestRegisterRoutesRejectsMissingAuth(t *testing.T) {
+	service := logicv1.NewUserService(newMemoryRepository(), logicv1.ServiceOptions{})
+	handler := webv1.NewUserHandler(service, webv1.HandlerOptions{})
+
+	gin.SetMode(gin.TestMode)
+	if err := webv1.RegisterRoutes(gin.New(), handler.Routes(), nil); err == nil {
+		t.Fatal("expected an error when auth-required routes are registered without auth middleware")
+	}
+}
+
+func TestRegisterRoutesWithPrefix(t *testing.T) {
+	service := logicv1.NewUserService(newMemoryRepository(), logicv1.ServiceOptions{})
+	handler := webv1.NewUserHandler(service, webv1.HandlerOptions{RoutePrefix: "/user-service"})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := webv1.RegisterRoutes(r.Group("/user-service"), handler.Routes(), fakeAuth()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doRequest(t, r, http.MethodPost, "/user-service/api/v1/users",
+		`{"username":"alice","email":"alice@example.com","name":"Alice Johnson"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusCreated, w.Body.String())
+	}
+	if got, want := w.Header().Get("Location"), "http://example.com/user-service/api/v1/users/105"; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+
+	if w := doRequest(t, r, http.MethodGet, "/api/v1/users/1", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unprefixed path status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestStrictQueryParams(t *testing.T) {
+	service := logicv1.NewUserService(newMemoryRepository(), logicv1.ServiceOptions{})
+	handler := webv1.NewUserHandler(service, webv1.HandlerOptions{StrictQueryParams: true})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := webv1.RegisterRoutes(r, handler.Routes(), fakeAuth()); err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{testUserHeader: "7"}
+
+	t.Run("declared param", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile?strict=false", "", headers)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+		}
+	})
+
+	t.Run("unknown param", func(t *testing.T) {
+		w := doRequest(t, r, http.MethodGet, "/api/v1/users/profile?strcit=true", "", headers)
+		assertError(t, w, http.StatusBadRequest)
+	})
+}
@@ -1,6 +1,150 @@
 package v1
 
-import "strings"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/duynhne/user-service/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Bind error phases recorded on the http.bind span.
+const (
+	bindErrorDecode     = "decode"
+	bindErrorValidation = "validation"
+	bindErrorDepth      = "depth"
+	bindErrorSize       = "size"
+)
+
+// DefaultMaxJSONDepth is the nesting limit applied when HandlerOptions.MaxJSONDepth is 0
+const DefaultMaxJSONDepth = 32
+
+// DefaultMaxBodyBytes is the body size limit applied when HandlerOptions.MaxBodyBytes is 0
+const DefaultMaxBodyBytes = 1 << 20
+
+// codeRequestTooLarge is the error code of 413 responses
+const codeRequestTooLarge = "request_too_large"
+
+// DefaultListMaxLimit is the list `limit` maximum applied when HandlerOptions.ListMaxLimit is 0
+const DefaultListMaxLimit = 100
+
+// errJSONTooDeep is returned when a request body nests objects/arrays beyond the limit
+var errJSONTooDeep = errors.New("json nesting too deep")
+
+// errBodyTooLarge is returned when a request body exceeds the size limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// bindJSON wraps JSON binding in an "http.bind" child span so traces show
+// whether a bad request failed while decoding the body or validating the fields.
+// Bodies larger than maxBytes are cut off while reading and bodies nested deeper
+// than maxDepth are rejected before decoding, so hostile payloads can neither
+// exhaust memory nor burn CPU in the reflection-based decoder.
+func bindJSON(ctx context.Context, c *gin.Context, obj any, maxDepth int, maxBytes int64) error {
+	_, span := middleware.StartSpan(ctx, "http.bind")
+	defer span.End()
+
+	err := decodeJSONBody(c, obj, maxDepth, maxBytes)
+	if err == nil {
+		return nil
+	}
+
+	span.SetAttributes(attribute.String("bind.error_type", bindErrorType(err)))
+	span.RecordError(err)
+	middleware.RecordDecodeError(c.FullPath())
+	return err
+}
+
+// decodeJSONBody reads at most maxBytes of the body, enforces the nesting limit
+// and binds it into obj
+func decodeJSONBody(c *gin.Context, obj any, maxDepth int, maxBytes int64) error {
+	if c.Request.Body == nil {
+		return errors.New("invalid request: missing body")
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("%w (max %d bytes)", errBodyTooLarge, tooLarge.Limit)
+		}
+		return fmt.Errorf("read request body: %w", err)
+	}
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxJSONDepth
+	}
+	if jsonDepthExceeds(data, maxDepth) {
+		return fmt.Errorf("%w (max %d)", errJSONTooDeep, maxDepth)
+	}
+	return binding.JSON.BindBody(data, obj)
+}
+
+// jsonDepthExceeds reports whether data nests objects/arrays deeper than maxDepth.
+// It is a single linear scan that ignores brackets inside strings; it does not
+// validate the JSON (the decoder does that afterwards).
+func jsonDepthExceeds(data []byte, maxDepth int) bool {
+	depth := 0
+	inString, escaped := false, false
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				return true
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return false
+}
+
+// bindErrorType classifies a binding error as a depth, decode or validation failure.
+func bindErrorType(err error) string {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return bindErrorValidation
+	}
+	if errors.Is(err, errJSONTooDeep) {
+		return bindErrorDepth
+	}
+	if errors.Is(err, errBodyTooLarge) {
+		return bindErrorSize
+	}
+	return bindErrorDecode
+}
+
+// writeBindError answers a bindJSON failure: 413 for an oversized body,
+// otherwise 400 with a sanitized message.
+func writeBindError(c *gin.Context, err error) {
+	if errors.Is(err, errBodyTooLarge) {
+		writeError(c, http.StatusRequestEntityTooLarge, codeRequestTooLarge, "Request body too large")
+		return
+	}
+	writeError(c, http.StatusBadRequest, codeInvalidRequest, sanitizeValidationError(err))
+}
 
 // sanitizeValidationError returns a user-friendly message for validation/binding errors.
 // Never expose raw gin/go validation errors to clients (security + UX).
@@ -23,3 +167,22 @@ func sanitizeValidationError(err error) string {
 	}
 	return "Invalid request"
 }
+
+// parseListLimit reads the optional `limit` query parameter of list endpoints.
+// It returns maxLimit when absent, so omitting it never means "unlimited".
+// Values above maxLimit are rejected rather than silently clamped, so clients
+// never mistake a truncated result for the full one.
+func parseListLimit(c *gin.Context, maxLimit int) (int, error) {
+	if maxLimit <= 0 {
+		maxLimit = DefaultListMaxLimit
+	}
+	raw := c.Query("limit")
+	if raw == "" {
+		return maxLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, fmt.Errorf("limit must be an integer between 1 and %d", maxLimit)
+	}
+	return limit, nil
+}
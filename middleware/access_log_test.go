@@ -0,0 +1,57 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestCombinedAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	if err := middleware.SetAccessLogFormat(middleware.AccessLogFormatCombined, &buf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = middleware.SetAccessLogFormat(middleware.AccessLogFormatJSON, nil) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.LoggingMiddleware(zap.NewNop(), false))
+	r.GET("/api/v1/users/:id", func(c *gin.Context) {
+		c.Set("user_id", "42")
+		c.String(http.StatusOK, "hello")
+	})
+	r.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/v1/users/7?x=1", nil)
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `curl/8 "quoted"`)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := regexp.MustCompile(`^192\.0\.2\.1 - 42 ` +
+		`\[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] ` +
+		`"GET /api/v1/users/7\?x=1 HTTP/1\.1" 200 5 "https://example\.com/" "curl/8 \\"quoted\\""\n$`)
+	if !want.Match(buf.Bytes()) {
+		t.Errorf("combined log line = %q", buf.String())
+	}
+
+	// Health checks are demoted to debug and stay out of the access log
+	buf.Reset()
+	health := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/health", nil)
+	r.ServeHTTP(httptest.NewRecorder(), health)
+	if buf.Len() != 0 {
+		t.Errorf("health check logged: %q", buf.String())
+	}
+}
+
+func TestSetAccessLogFormatRejectsUnknown(t *testing.T) {
+	if err := middleware.SetAccessLogFormat("apache", nil); err == nil {
+		t.Error("SetAccessLogFormat(\"apache\") expected error")
+	}
+}
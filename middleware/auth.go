@@ -7,42 +7,175 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 // AuthUser represents the user info returned from auth service
 type AuthUser struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// DefaultAuthClientTimeout bounds each auth-service request
+const DefaultAuthClientTimeout = 5 * time.Second
+
+// DefaultAuthMaxResponseBytes caps how much of an auth-service response body is read
+const DefaultAuthMaxResponseBytes int64 = 64 << 10
+
+// ErrAuthRateLimited is returned (wrapped in *AuthRateLimitedError) when the
+// auth service answers 429 Too Many Requests.
+var ErrAuthRateLimited = errors.New("auth service rate limited")
+
+// ErrAuthInvalidUser is returned when the auth service answers 200 but the
+// decoded user has no ID; such responses are never cached.
+var ErrAuthInvalidUser = errors.New("auth service returned invalid user")
+
+// ErrAuthBusy is returned when no auth-service slot (AuthClientOptions.MaxConcurrent)
+// frees up within the client timeout; AuthMiddleware answers 503 with Retry-After.
+var ErrAuthBusy = errors.New("auth service busy")
+
+// AuthRateLimitedError carries the upstream Retry-After value of a 429 response
+type AuthRateLimitedError struct {
+	RetryAfter string // raw Retry-After header from the auth service (may be empty)
+}
+
+func (e *AuthRateLimitedError) Error() string {
+	if e.RetryAfter == "" {
+		return ErrAuthRateLimited.Error()
+	}
+	return ErrAuthRateLimited.Error() + " (retry after " + e.RetryAfter + ")"
+}
+
+// Unwrap lets errors.Is(err, ErrAuthRateLimited) match
+func (e *AuthRateLimitedError) Unwrap() error {
+	return ErrAuthRateLimited
+}
+
+// AuthClientOptions tunes the auth client; zero values select defaults
+type AuthClientOptions struct {
+	// Cache is optional; when nil every GetMe call goes to the auth service.
+	Cache TokenCache
+	// Timeout bounds each auth-service request (default: 5s).
+	Timeout time.Duration
+	// MaxResponseBytes bounds response body reads (default: 64KB) so a misbehaving
+	// auth service cannot exhaust our memory.
+	MaxResponseBytes int64
+	// MaxConcurrent limits simultaneous introspection calls to the auth service
+	// (0 = unlimited). Callers beyond the limit wait at most Timeout for a slot,
+	// then fail with ErrAuthBusy.
+	MaxConcurrent int
 }
 
 // AuthClient handles communication with the auth service
 type AuthClient struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL          string
+	httpClient       *http.Client
+	cache            TokenCache
+	maxResponseBytes int64
+	sem              chan struct{} // nil when concurrency is unlimited
+	slotWait         time.Duration // longest wait for a sem slot (the client timeout)
+	health           authHealthState
 }
 
 // NewAuthClient creates a new auth client
-func NewAuthClient(baseURL string) *AuthClient {
+func NewAuthClient(baseURL string, opts AuthClientOptions) *AuthClient {
+	maxResponseBytes := opts.MaxResponseBytes
+	if maxResponseBytes <= 0 {
+		maxResponseBytes = DefaultAuthMaxResponseBytes
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultAuthClientTimeout
+	}
+	var sem chan struct{}
+	if opts.MaxConcurrent > 0 {
+		sem = make(chan struct{}, opts.MaxConcurrent)
+	}
 	return &AuthClient{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
+			Timeout: timeout,
 		},
+		cache:            opts.Cache,
+		maxResponseBytes: maxResponseBytes,
+		sem:              sem,
+		slotWait:         timeout,
 	}
 }
 
 // GetMe retrieves user info from auth service using the token
-func (c *AuthClient) GetMe(token string) (*AuthUser, error) {
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, c.baseURL+"/api/v1/auth/me", nil)
+// Successful lookups are served from the token cache when one is configured.
+// Every call records an "auth.introspect" span (cache hits included) with
+// auth.cache_hit, so each authenticated request shows the same auth phase in traces.
+func (c *AuthClient) GetMe(ctx context.Context, token string) (*AuthUser, error) {
+	ctx, span := StartSpan(ctx, "auth.introspect", trace.WithAttributes(
+		attribute.String("layer", "auth"),
+		attribute.Bool("auth.cache_enabled", c.cache != nil),
+	))
+	defer span.End()
+
+	if c.cache != nil {
+		if user, ok := c.cache.Get(token); ok {
+			span.SetAttributes(attribute.Bool("auth.cache_hit", true))
+			span.AddEvent("auth.cache_hit")
+			return user, nil
+		}
+	}
+	span.SetAttributes(attribute.Bool("auth.cache_hit", false))
+
+	if c.sem != nil {
+		release, err := c.acquireSlot(ctx)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		defer release()
+	}
+
+	user, err := c.fetchMe(ctx, token)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if c.cache != nil {
+		c.cache.Set(token, user)
+	}
+	return user, nil
+}
+
+// acquireSlot reserves one of the MaxConcurrent auth-service slots, waiting at
+// most the client timeout so a saturated auth service sheds load instead of
+// queueing requests until their clients give up.
+func (c *AuthClient) acquireSlot(ctx context.Context) (release func(), err error) {
+	timer := time.NewTimer(c.slotWait)
+	defer timer.Stop()
+	select {
+	case c.sem <- struct{}{}:
+		return func() { <-c.sem }, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("wait for auth service slot: %w", ErrAuthBusy)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait for auth service slot: %w: %w", ErrAuthBusy, ctx.Err())
+	}
+}
+
+// fetchMe calls the auth service /me endpoint
+func (c *AuthClient) fetchMe(ctx context.Context, token string) (*AuthUser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/auth/me", nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Authorization", bearerPrefix+token)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -53,62 +186,130 @@ func (c *AuthClient) GetMe(token string) (*AuthUser, error) {
 	if resp.StatusCode == http.StatusUnauthorized {
 		return nil, errors.New("invalid or expired token")
 	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &AuthRateLimitedError{RetryAfter: resp.Header.Get("Retry-After")}
+	}
+	body := io.LimitReader(resp.Body, c.maxResponseBytes)
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("auth service error: %d - %s", resp.StatusCode, string(body))
+		msg, _ := io.ReadAll(body)
+		return nil, fmt.Errorf("auth service error: %d - %s", resp.StatusCode, string(msg))
 	}
 
 	var user AuthUser
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+	if err := json.NewDecoder(body).Decode(&user); err != nil {
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
+	// An empty ID would put "" into user_id and let handlers act on no one
+	if strings.TrimSpace(user.ID) == "" {
+		return nil, ErrAuthInvalidUser
+	}
 
 	return &user, nil
 }
 
 // AuthMiddleware creates a middleware that validates tokens via auth service
-// It sets "user_id", "username", "email" in the gin context if authentication succeeds.
+// It sets "user_id", "username", "email", "roles" in the gin context if authentication succeeds.
 // When allowUnauthenticatedFallback is true (demo mode), missing/invalid tokens fall back to user_id="1".
 // When false (default), returns 401 for missing or invalid tokens.
-func AuthMiddleware(authClient *AuthClient, logger *zap.Logger, allowUnauthenticatedFallback bool) gin.HandlerFunc {
+// A 429 from the auth service is passed through (with Retry-After and X-RateLimit-*,
+// see SetRetryAfter) regardless of fallback, and so is saturation of the
+// auth-service slots (ErrAuthBusy, 503 with Retry-After).
+// When internalAuth is non-nil, a valid signed internal identity header is accepted
+// without calling the auth service (see InternalAuth for the threat model).
+func AuthMiddleware(
+	authClient *AuthClient,
+	logger *zap.Logger,
+	allowUnauthenticatedFallback bool,
+	internalAuth *InternalAuth,
+) gin.HandlerFunc {
+	// Never run without a logger: fall back to the default production logger
+	if logger == nil {
+		if l, err := NewLogger(); err == nil {
+			logger = l
+		} else {
+			logger = zap.NewNop()
+		}
+	}
+
+	fallback := &authFallback{logger: logger}
+
 	return func(c *gin.Context) {
+		// Trusted service-to-service identity (no fallback on failure)
+		if internalAuth != nil {
+			if value := c.GetHeader(internalAuth.Header()); value != "" {
+				userID, err := internalAuth.Verify(value, c.RemoteIP())
+				if err != nil {
+					logger.Warn("Internal identity rejected", zap.Error(err))
+					c.AbortWithStatusJSON(http.StatusUnauthorized,
+						ErrorBody(CodeInvalidToken, "Invalid internal identity"))
+					return
+				}
+				c.Set("user_id", userID)
+				c.Set("auth_source", "internal")
+				c.Next()
+				return
+			}
+		}
+
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			if allowUnauthenticatedFallback {
-				c.Set("user_id", "1")
-				c.Next()
+				fallback.serveAsDemoUser(c, authFallbackMissingToken)
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized,
+				ErrorBody(CodeUnauthenticated, "Authentication required"))
 			return
 		}
 
-		// Extract token from "Bearer <token>"
-		const bearerPrefix = "Bearer "
-		if len(authHeader) <= len(bearerPrefix) || authHeader[:len(bearerPrefix)] != bearerPrefix {
+		// Extract token from "Bearer <token>"; a blank token never reaches the auth service
+		token, ok := bearerToken(authHeader)
+		if !ok {
 			if allowUnauthenticatedFallback {
-				c.Set("user_id", "1")
-				c.Next()
+				fallback.serveAsDemoUser(c, authFallbackInvalidHeader)
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized,
+				ErrorBody(CodeInvalidToken, "Invalid authorization header"))
 			return
 		}
-		token := authHeader[len(bearerPrefix):]
 
 		// Call auth service to validate token
-		user, err := authClient.GetMe(token)
+		user, err := authClient.GetMe(c.Request.Context(), token)
 		if err != nil {
-			if logger != nil {
-				logger.Debug("Auth validation failed", zap.Error(err))
+			// Propagate auth-service backpressure instead of masking it as a bad token
+			var rateLimited *AuthRateLimitedError
+			if errors.As(err, &rateLimited) {
+				logger.Warn("Auth service rate limited", zap.String("retry_after", rateLimited.RetryAfter))
+				retryAfter := ParseRetryAfter(rateLimited.RetryAfter)
+				SetRetryAfter(c, retryAfter)
+				SetRateLimitHeaders(c, 0, retryAfter)
+				c.AbortWithStatusJSON(http.StatusTooManyRequests,
+					ErrorBody(CodeRateLimited, "Too many requests"))
+				return
 			}
+			// Our own limit on auth-service calls is backpressure too, never a bad token
+			if errors.Is(err, ErrAuthBusy) {
+				logger.Warn("Auth service slots exhausted", zap.Error(err))
+				SetRetryAfter(c, 0)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable,
+					ErrorBody(CodeServiceBusy, "Service busy, please retry"))
+				return
+			}
+			logger.Debug("Auth validation failed", zap.Error(err))
 			if allowUnauthenticatedFallback {
-				c.Set("user_id", "1")
-				c.Next()
+				fallback.serveAsDemoUser(c, authFallbackInvalidToken)
+				return
+			}
+			if errors.Is(err, ErrAuthInvalidUser) {
+				logger.Warn("Auth service returned invalid user")
+				c.AbortWithStatusJSON(http.StatusUnauthorized,
+					ErrorBody(CodeInvalidToken, "Auth service returned invalid user"))
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized,
+				ErrorBody(CodeInvalidToken, "Invalid or expired token"))
 			return
 		}
 
@@ -116,6 +317,74 @@ func AuthMiddleware(authClient *AuthClient, logger *zap.Logger, allowUnauthentic
 		c.Set("user_id", user.ID)
 		c.Set("username", user.Username)
 		c.Set("email", user.Email)
+		c.Set("roles", user.Roles)
 		c.Next()
 	}
 }
+
+// auth_fallback_total reasons
+const (
+	authFallbackMissingToken  = "missing_token"
+	authFallbackInvalidHeader = "invalid_header"
+	authFallbackInvalidToken  = "invalid_token"
+)
+
+// authFallbackWarnInterval is the minimum gap between fallback warnings
+const authFallbackWarnInterval = time.Minute
+
+// authFallback serves requests as the demo user (AUTH_ALLOW_UNAUTHENTICATED_FALLBACK).
+// Every fallback is counted in auth_fallback_total; while fallbacks keep happening
+// a warning is logged at most once per authFallbackWarnInterval, because any
+// fallback in production means authentication is effectively off.
+type authFallback struct {
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	pending  int // fallbacks since the last warning
+	lastWarn time.Time
+}
+
+// serveAsDemoUser continues the request as user "1"
+func (f *authFallback) serveAsDemoUser(c *gin.Context, reason string) {
+	authFallbackTotal.WithLabelValues(reason).Inc()
+	f.warn(reason)
+	c.Set("user_id", "1")
+	c.Next()
+}
+
+func (f *authFallback) warn(reason string) {
+	f.mu.Lock()
+	f.pending++
+	now := time.Now()
+	if now.Sub(f.lastWarn) < authFallbackWarnInterval {
+		f.mu.Unlock()
+		return
+	}
+	count := f.pending
+	f.pending = 0
+	f.lastWarn = now
+	f.mu.Unlock()
+
+	f.logger.Warn("Requests served as demo user by unauthenticated auth fallback",
+		zap.Int("fallbacks", count),
+		zap.String("last_reason", reason),
+		zap.Duration("warn_interval", authFallbackWarnInterval),
+	)
+}
+
+// bearerPrefix is the Authorization scheme AuthMiddleware accepts
+const bearerPrefix = "Bearer "
+
+// bearerToken extracts the token from a "Bearer <token>" header value. The
+// scheme is matched case-insensitively (RFC 7235); the token is kept verbatim.
+// ok is false when the scheme is missing or the token is empty or only whitespace.
+func bearerToken(authHeader string) (token string, ok bool) {
+	if len(authHeader) < len(bearerPrefix) {
+		return "", false
+	}
+	if !strings.EqualFold(authHeader[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	token = strings.TrimSpace(authHeader[len(bearerPrefix):])
+	return token, token != ""
+}
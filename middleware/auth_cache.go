@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// authCacheStatsLogInterval is how many lookups happen between hit-ratio log lines
+const authCacheStatsLogInterval = 1000
+
+// TokenCache caches auth-service introspection results keyed by token
+type TokenCache interface {
+	Get(token string) (*AuthUser, bool)
+	Set(token string, user *AuthUser)
+	Len() int
+}
+
+type tokenCacheEntry struct {
+	user      *AuthUser
+	expiresAt time.Time
+}
+
+// MemoryTokenCache is an in-process TTL cache for introspected tokens.
+// Tokens are stored as SHA-256 hashes so raw credentials never sit in memory maps.
+type MemoryTokenCache struct {
+	mu         sync.Mutex
+	entries    map[string]tokenCacheEntry
+	ttl        time.Duration
+	maxEntries int
+	logger     *zap.Logger
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewMemoryTokenCache creates a token cache holding at most maxEntries for ttl each
+func NewMemoryTokenCache(ttl time.Duration, maxEntries int, logger *zap.Logger) *MemoryTokenCache {
+	return &MemoryTokenCache{
+		entries:    make(map[string]tokenCacheEntry),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		logger:     logger,
+	}
+}
+
+// Get returns the cached user for token if present and not expired
+func (c *MemoryTokenCache) Get(token string) (*AuthUser, bool) {
+	key := hashToken(token)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		ok = false
+	}
+	size := len(c.entries)
+	c.mu.Unlock()
+
+	authCacheSize.Set(float64(size))
+	if ok {
+		authCacheHits.Inc()
+		c.hits.Add(1)
+	} else {
+		authCacheMisses.Inc()
+		c.misses.Add(1)
+	}
+	c.maybeLogStats()
+
+	if !ok {
+		return nil, false
+	}
+	return entry.user, true
+}
+
+// Set stores user for token. When the cache is full, expired entries are purged
+// first; if it is still full the entry is not cached.
+func (c *MemoryTokenCache) Set(token string, user *AuthUser) {
+	key := hashToken(token)
+	now := time.Now()
+
+	c.mu.Lock()
+	if len(c.entries) >= c.maxEntries {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) < c.maxEntries {
+		c.entries[key] = tokenCacheEntry{user: user, expiresAt: now.Add(c.ttl)}
+	}
+	size := len(c.entries)
+	c.mu.Unlock()
+
+	authCacheSize.Set(float64(size))
+}
+
+// Len returns the number of cached entries (including not-yet-purged expired ones)
+func (c *MemoryTokenCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// maybeLogStats logs the cumulative hit ratio every authCacheStatsLogInterval lookups
+func (c *MemoryTokenCache) maybeLogStats() {
+	if c.logger == nil {
+		return
+	}
+	hits, misses := c.hits.Load(), c.misses.Load()
+	total := hits + misses
+	if total == 0 || total%authCacheStatsLogInterval != 0 {
+		return
+	}
+	c.logger.Info("Auth cache stats",
+		zap.Uint64("hits", hits),
+		zap.Uint64("misses", misses),
+		zap.Float64("hit_ratio", float64(hits)/float64(total)),
+		zap.Int("size", c.Len()),
+	)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
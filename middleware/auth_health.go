@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// authHealthCacheTTL is how long an auth-service health result is reused, so
+// frequent readiness probes do not hammer the auth service.
+const authHealthCacheTTL = 5 * time.Second
+
+// authHealthPath is the auth service's unauthenticated liveness endpoint
+const authHealthPath = "/health"
+
+// authHealthState caches the latest auth-service health check result
+type authHealthState struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// CheckHealth reports whether the auth service answers its health endpoint
+// with 2xx. Results (healthy or not) are cached for 5s; concurrent callers
+// share one in-flight check.
+func (c *AuthClient) CheckHealth(ctx context.Context) error {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+
+	if !c.health.checkedAt.IsZero() && time.Since(c.health.checkedAt) < authHealthCacheTTL {
+		return c.health.err
+	}
+	c.health.err = c.fetchHealth(ctx)
+	c.health.checkedAt = time.Now()
+	return c.health.err
+}
+
+// fetchHealth performs one GET against the auth service health endpoint
+func (c *AuthClient) fetchHealth(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+authHealthPath, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request auth service health: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("auth service health: status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestAuthClientCheckHealth(t *testing.T) {
+	var calls atomic.Int32
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/health" {
+			t.Errorf("path = %q, want /health", r.URL.Path)
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	client := middleware.NewAuthClient(srv.URL, middleware.AuthClientOptions{})
+	if err := client.CheckHealth(t.Context()); err != nil {
+		t.Fatalf("CheckHealth() = %v, want nil", err)
+	}
+
+	// Within the cache window the auth service is not called again, even if it went down
+	status.Store(http.StatusServiceUnavailable)
+	if err := client.CheckHealth(t.Context()); err != nil {
+		t.Fatalf("cached CheckHealth() = %v, want nil", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("auth service called %d times, want 1", got)
+	}
+
+	unhealthy := middleware.NewAuthClient(srv.URL, middleware.AuthClientOptions{})
+	if err := unhealthy.CheckHealth(t.Context()); err == nil {
+		t.Error("CheckHealth() = nil, want error for 503")
+	}
+}
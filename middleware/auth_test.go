@@ -0,0 +1,318 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+// newAuthServer fakes the auth service /me endpoint, accepting only validToken
+func newAuthServer(t *testing.T, validToken string, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "Bearer "+validToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(middleware.AuthUser{ID: "42", Username: "alice"})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newAuthRouter(authURL string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	client := middleware.NewAuthClient(authURL, middleware.AuthClientOptions{})
+	r.Use(middleware.AuthMiddleware(client, zap.NewNop(), false, nil))
+	r.GET("/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id")})
+	})
+	return r
+}
+
+func TestAuthMiddlewareBearerToken(t *testing.T) {
+	var calls atomic.Int32
+	r := newAuthRouter(newAuthServer(t, "s3cret", &calls).URL)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantCall   bool
+		wantCode   string // error envelope code ("" for success)
+	}{
+		{name: "valid token", header: "Bearer s3cret", wantStatus: http.StatusOK, wantCall: true},
+		{name: "lowercase scheme", header: "bearer s3cret", wantStatus: http.StatusOK, wantCall: true},
+		{name: "uppercase scheme", header: "BEARER s3cret", wantStatus: http.StatusOK, wantCall: true},
+		{
+			name:       "token stays case-sensitive",
+			header:     "Bearer S3CRET",
+			wantStatus: http.StatusUnauthorized,
+			wantCall:   true,
+			wantCode:   "invalid_token",
+		},
+		{
+			name: "whitespace token", header: "Bearer   ",
+			wantStatus: http.StatusUnauthorized, wantCode: "invalid_token",
+		},
+		{
+			name: "empty token", header: "Bearer ",
+			wantStatus: http.StatusUnauthorized, wantCode: "invalid_token",
+		},
+		{
+			name: "missing scheme", header: "s3cret",
+			wantStatus: http.StatusUnauthorized, wantCode: "invalid_token",
+		},
+		{name: "no header", wantStatus: http.StatusUnauthorized, wantCode: "unauthenticated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", tt.header)
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if gotCall := calls.Load() > 0; gotCall != tt.wantCall {
+				t.Errorf("auth service called = %v, want %v", gotCall, tt.wantCall)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode {
+				t.Errorf("body = %s, want code %q", w.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareInvalidUser(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"  ","username":"ghost"}`))
+	}))
+	t.Cleanup(srv.Close)
+	r := newAuthRouter(srv.URL)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	if body.Error != "Auth service returned invalid user" {
+		t.Errorf("error = %q, want %q", body.Error, "Auth service returned invalid user")
+	}
+
+	client := middleware.NewAuthClient(srv.URL, middleware.AuthClientOptions{})
+	if _, err := client.GetMe(t.Context(), "s3cret"); !errors.Is(err, middleware.ErrAuthInvalidUser) {
+		t.Errorf("GetMe error = %v, want ErrAuthInvalidUser", err)
+	}
+}
+
+func TestAuthMiddlewareRateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(srv.Close)
+	r := newAuthRouter(srv.URL)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "7" {
+		t.Errorf("Retry-After = %q, want 7", got)
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != "rate_limited" {
+		t.Errorf("body = %s, want code rate_limited", w.Body.String())
+	}
+}
+
+func TestAuthMiddlewareBusy(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-release
+		_ = json.NewEncoder(w).Encode(middleware.AuthUser{ID: "42"})
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	gin.SetMode(gin.TestMode)
+	client := middleware.NewAuthClient(srv.URL, middleware.AuthClientOptions{MaxConcurrent: 1})
+	// Hold the only slot until the test ends
+	go func() { _, _ = client.GetMe(context.Background(), "holder") }()
+	<-entered
+
+	// Saturation is backpressure: 503 even when the unauthenticated fallback is on
+	for _, fallback := range []bool{false, true} {
+		r := gin.New()
+		r.Use(middleware.AuthMiddleware(client, zap.NewNop(), fallback, nil))
+		r.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		r.ServeHTTP(w, req)
+		cancel()
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("fallback=%v: status = %d, want %d", fallback, w.Code, http.StatusServiceUnavailable)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Errorf("fallback=%v: missing Retry-After", fallback)
+		}
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != "service_busy" {
+			t.Errorf("fallback=%v: body = %s, want code service_busy", fallback, w.Body.String())
+		}
+	}
+
+	// Without a request deadline the wait is bounded by the client timeout
+	bounded := middleware.NewAuthClient(srv.URL, middleware.AuthClientOptions{
+		Timeout:       20 * time.Millisecond,
+		MaxConcurrent: 1,
+	})
+	go func() { _, _ = bounded.GetMe(context.Background(), "holder") }()
+	<-entered
+	start := time.Now()
+	if _, err := bounded.GetMe(context.Background(), "s3cret"); err == nil {
+		t.Fatal("GetMe succeeded while the only slot was held")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetMe waited %v for a slot, want about the 20ms client timeout", elapsed)
+	}
+}
+
+func TestAuthMiddlewareFallbackMetric(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zapcore.WarnLevel)
+	client := middleware.NewAuthClient("http://127.0.0.1:0", middleware.AuthClientOptions{})
+	r := gin.New()
+	r.Use(middleware.AuthMiddleware(client, zap.New(core), true, nil))
+	r.GET("/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id")})
+	})
+
+	before := authFallbackCount(t, "missing_token")
+	for range 3 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/me", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+	}
+
+	if got := authFallbackCount(t, "missing_token") - before; got != 3 {
+		t.Errorf("auth_fallback_total{reason=missing_token} grew by %v, want 3", got)
+	}
+	// Warnings are rate limited: the first fallback logs, the rest wait for the interval
+	if got := logs.Len(); got != 1 {
+		t.Errorf("logged %d fallback warnings, want 1", got)
+	}
+}
+
+// TestAuthMiddlewareNilLogger checks that a nil logger is replaced instead of
+// panicking on the paths that log.
+func TestAuthMiddlewareNilLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := middleware.NewAuthClient("http://127.0.0.1:0", middleware.AuthClientOptions{})
+
+	tests := []struct {
+		name       string
+		fallback   bool
+		authHeader string
+		wantStatus int
+	}{
+		{name: "missing token", wantStatus: http.StatusUnauthorized},
+		{name: "fallback on missing token", fallback: true, wantStatus: http.StatusOK},
+		{
+			name:       "fallback on auth service error",
+			fallback:   true,
+			authHeader: "Bearer some-token",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(middleware.AuthMiddleware(client, nil, tt.fallback, nil))
+			r.GET("/me", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id")})
+			})
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/me", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body=%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+// authFallbackCount reads auth_fallback_total for reason from the default registry
+func authFallbackCount(t *testing.T, reason string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "auth_fallback_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "reason" && label.GetValue() == reason {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
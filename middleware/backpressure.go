@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Backpressure headers. Contract for clients (see README "Backpressure"):
+//   - Every 429 and 503 response carries Retry-After in whole seconds; wait at
+//     least that long before retrying the request.
+//   - Rate-limited responses also carry X-RateLimit-Remaining (requests left in
+//     the current window) and X-RateLimit-Reset (seconds until the window resets).
+const (
+	RetryAfterHeader         = "Retry-After"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// DefaultRetryAfter is used when no more specific retry hint is known
+const DefaultRetryAfter = time.Second
+
+// defaultRetryAfter holds the RETRY_AFTER setting (nanoseconds)
+var defaultRetryAfter atomic.Int64
+
+func init() {
+	defaultRetryAfter.Store(int64(DefaultRetryAfter))
+}
+
+// SetDefaultRetryAfter sets the Retry-After used by SetRetryAfter when the caller
+// has no better hint (RETRY_AFTER). Call at startup; d <= 0 is ignored.
+func SetDefaultRetryAfter(d time.Duration) {
+	if d > 0 {
+		defaultRetryAfter.Store(int64(d))
+	}
+}
+
+// SetRetryAfter writes Retry-After for a 429/503 response. d <= 0 selects the
+// configured default. Values are rounded up to whole seconds (minimum 1).
+func SetRetryAfter(c *gin.Context, d time.Duration) {
+	if d <= 0 {
+		d = time.Duration(defaultRetryAfter.Load())
+	}
+	c.Header(RetryAfterHeader, strconv.Itoa(retryAfterSeconds(d)))
+}
+
+// SetRateLimitHeaders writes the rate-limit window state; reset is the time until
+// the window resets. Pair with SetRetryAfter on 429 responses.
+func SetRateLimitHeaders(c *gin.Context, remaining int, reset time.Duration) {
+	c.Header(RateLimitRemainingHeader, strconv.Itoa(max(remaining, 0)))
+	c.Header(RateLimitResetHeader, strconv.Itoa(retryAfterSeconds(reset)))
+}
+
+// ParseRetryAfter parses a Retry-After value in delay-seconds or HTTP-date form;
+// it returns 0 when value is empty or invalid.
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := time.Parse(time.RFC1123, value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int((d + time.Second - 1) / time.Second)
+	return max(seconds, 1)
+}
@@ -0,0 +1,50 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestSetRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name  string
+		delay time.Duration
+		want  string
+	}{
+		{name: "default", delay: 0, want: "1"},
+		{name: "rounded up", delay: 1500 * time.Millisecond, want: "2"},
+		{name: "sub-second", delay: 10 * time.Millisecond, want: "1"},
+		{name: "whole seconds", delay: 30 * time.Second, want: "30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			middleware.SetRetryAfter(c, tt.delay)
+			c.Status(http.StatusServiceUnavailable)
+
+			if got := w.Header().Get(middleware.RetryAfterHeader); got != tt.want {
+				t.Errorf("Retry-After = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := middleware.ParseRetryAfter("7"); got != 7*time.Second {
+		t.Errorf("ParseRetryAfter(7) = %s, want 7s", got)
+	}
+	for _, value := range []string{"", "soon"} {
+		if got := middleware.ParseRetryAfter(value); got != 0 {
+			t.Errorf("ParseRetryAfter(%q) = %s, want 0", value, got)
+		}
+	}
+}
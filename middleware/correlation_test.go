@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+// TestTraceCorrelation guards the trace_id <-> span correlation: the trace id
+// written by LoggingMiddleware must match the trace id of the span recorded by
+// TracingMiddleware for a request carrying a W3C traceparent.
+func TestTraceCorrelation(t *testing.T) {
+	const (
+		traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+		traceParent = "00-" + traceID + "-00f067aa0ba902b7-01"
+	)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+	t.Cleanup(func() { _ = tp.Shutdown(t.Context()) })
+
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.TracingMiddleware())
+	r.Use(middleware.LoggingMiddleware(logger, false))
+	r.GET("/api/v1/ping", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ping", http.NoBody)
+	req.Header.Set("traceparent", traceParent)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	entries := logs.FilterMessage("HTTP request").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 access log entry, got %d", len(entries))
+	}
+	loggedTraceID, _ := entries[0].ContextMap()["trace_id"].(string)
+
+	spans := exporter.GetSpans()
+	if len(spans) == 0 {
+		t.Fatal("expected at least one exported span")
+	}
+	spanTraceID := spans[0].SpanContext.TraceID().String()
+
+	if loggedTraceID != spanTraceID {
+		t.Errorf("logged trace_id %q does not match span trace id %q", loggedTraceID, spanTraceID)
+	}
+	if spanTraceID != traceID {
+		t.Errorf("span trace id = %q, want incoming %q", spanTraceID, traceID)
+	}
+	if got := w.Header().Get(middleware.TraceIDHeader); got != traceID {
+		t.Errorf("%s header = %q, want %q", middleware.TraceIDHeader, got, traceID)
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/duynhne/user-service/config"
+)
+
+// TraceDebugHandler reports the OpenTelemetry sampling decision for the current request.
+// Helps developers understand why a trace did not show up in Tempo.
+// Register only outside production.
+func TraceDebugHandler(tracingEnabled bool, sampleRate float64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		spanCtx := trace.SpanContextFromContext(c.Request.Context())
+
+		resp := gin.H{
+			"tracing_enabled": tracingEnabled,
+			"sample_rate":     sampleRate,
+			"sampled":         spanCtx.IsSampled(),
+			"log_trace_id":    c.GetString("trace_id"),
+		}
+		if spanCtx.HasTraceID() {
+			resp["trace_id"] = spanCtx.TraceID().String()
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ConfigDebugHandler returns the effective configuration with secrets redacted.
+// Helps debug env precedence without shelling into the pod.
+// Register only outside production; it also refuses to serve in production.
+func ConfigDebugHandler(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.IsProduction() {
+			c.JSON(http.StatusNotFound, ErrorBody(CodeNotFound, "Not found"))
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, cfg.LogSafe())
+	}
+}
+
+// TraceFlushHandler force-flushes buffered spans so they show up in Tempo right
+// away instead of after the next batch export. The flush is bounded by
+// OTEL_EXPORT_TIMEOUT; an exporter failure is reported as 502.
+// Register only outside production; it also refuses to serve in production.
+func TraceFlushHandler(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.IsProduction() {
+			c.JSON(http.StatusNotFound, ErrorBody(CodeNotFound, "Not found"))
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.Timeouts.OTelExport)
+		defer cancel()
+		start := time.Now()
+		flushed, err := ForceFlush(ctx)
+		resp := gin.H{
+			"tracing_enabled": cfg.Tracing.Enabled,
+			"flushed":         flushed,
+			"duration_ms":     time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			resp["error"] = err.Error()
+			c.JSON(http.StatusBadGateway, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
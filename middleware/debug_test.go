@@ -0,0 +1,55 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/duynhne/user-service/config"
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestTraceFlushHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		env        string
+		wantStatus int
+	}{
+		{name: "tracing not initialized", env: "development", wantStatus: http.StatusOK},
+		{name: "production", env: "production", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Service:  config.ServiceConfig{Env: tt.env},
+				Timeouts: config.TimeoutsConfig{OTelExport: time.Second},
+			}
+			r := gin.New()
+			r.POST("/debug/trace/flush", middleware.TraceFlushHandler(cfg))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/trace/flush", http.NoBody))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body=%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var body struct {
+				Flushed bool `json:"flushed"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if body.Flushed {
+				t.Error("flushed = true, want false without a tracer provider")
+			}
+		})
+	}
+}
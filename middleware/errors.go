@@ -0,0 +1,23 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// Error codes for responses written by middleware and fallback routes; handler
+// errors carry their domain error code (see webv1.errorMappings).
+const (
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	// CodeServiceBusy matches domain.ErrServiceBusy's code
+	CodeServiceBusy = "service_busy"
+
+	// AuthMiddleware failures
+	CodeUnauthenticated = "unauthenticated" // no credentials sent
+	CodeInvalidToken    = "invalid_token"   // credentials rejected or unusable
+	CodeRateLimited     = "rate_limited"    // auth service answered 429
+)
+
+// ErrorBody builds the standard error envelope: {"error": <message>, "code": <code>}.
+// Every JSON error response uses it so clients can switch on "code".
+func ErrorBody(code, message string) gin.H {
+	return gin.H{"error": message, "code": code}
+}
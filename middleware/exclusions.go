@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"slices"
+	"strings"
+)
+
+// defaultExcludedPaths are infrastructure endpoints skipped by tracing and metrics.
+// Health checks and scrapes are high-volume, have no business value, and would
+// otherwise dominate request metrics and trace storage.
+var defaultExcludedPaths = []string{
+	"/health", "/healthz",
+	"/ready", "/readyz", "/readiness",
+	"/livez", "/liveness",
+	"/metrics",
+	"/favicon.ico",
+}
+
+// exactExcludedPaths are skipped by tracing and metrics on an exact match only
+// (every path starts with "/", so the root descriptor cannot be a prefix).
+var exactExcludedPaths = []string{"/"}
+
+// metricsOnlyExcludedPaths are skipped by metrics but still traced
+// (debug endpoints need a live span to report on).
+var metricsOnlyExcludedPaths = []string{"/debug"}
+
+// excludedPaths is the effective exclusion list shared by tracing and metrics.
+// Set once at startup via SetExcludedPaths before the server starts.
+var excludedPaths = defaultExcludedPaths
+
+// SetExcludedPaths extends the default exclusion list with operator-provided path prefixes
+// (OBSERVABILITY_EXCLUDE_PATHS). Must be called before the HTTP server starts.
+func SetExcludedPaths(extra []string) {
+	paths := make([]string, 0, len(defaultExcludedPaths)+len(extra))
+	paths = append(paths, defaultExcludedPaths...)
+	for _, p := range extra {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	excludedPaths = paths
+}
+
+// ExcludedPaths returns the effective exclusion list
+func ExcludedPaths() []string {
+	return excludedPaths
+}
+
+// isMetricsOnlyExcludedPath reports whether path is excluded from metrics only
+func isMetricsOnlyExcludedPath(path string) bool {
+	for _, skip := range metricsOnlyExcludedPaths {
+		if strings.HasPrefix(path, skip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcludedPath reports whether path matches one of the excluded prefixes
+// or exact paths
+func isExcludedPath(path string) bool {
+	if slices.Contains(exactExcludedPaths, path) {
+		return true
+	}
+	for _, skip := range excludedPaths {
+		if strings.HasPrefix(path, skip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustedProxies decides whether X-Forwarded-Proto / X-Forwarded-Host may be
+// honored for a request. Only the TCP peer address is checked: forwarded headers
+// from any other source are client-controlled and ignored.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// NewTrustedProxies parses proxy CIDRs or bare IPs (e.g. "10.0.0.0/8", "192.168.1.10")
+func NewTrustedProxies(entries []string) (*TrustedProxies, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		ipNet, err := parseCIDROrIP(entry)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return &TrustedProxies{nets: nets}, nil
+}
+
+func parseCIDROrIP(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, fmt.Errorf("parse trusted proxy %q: %w", entry, err)
+	}
+	return ipNet, nil
+}
+
+// isTrusted reports whether remoteIP belongs to a trusted proxy
+func (t *TrustedProxies) isTrusted(remoteIP string) bool {
+	if t == nil {
+		return false
+	}
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range t.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExternalURL builds the absolute URL clients use to reach path.
+// X-Forwarded-Proto and X-Forwarded-Host are used only when the request comes
+// from a trusted proxy; otherwise the request's own scheme and Host are used.
+// A nil TrustedProxies trusts no proxy.
+func (t *TrustedProxies) ExternalURL(c *gin.Context, path string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	host := c.Request.Host
+
+	if t.isTrusted(c.RemoteIP()) {
+		if proto := firstForwardedValue(c.GetHeader("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwdHost := firstForwardedValue(c.GetHeader("X-Forwarded-Host")); isValidForwardedHost(fwdHost) {
+			host = fwdHost
+		}
+	}
+	return scheme + "://" + host + path
+}
+
+// firstForwardedValue returns the left-most (client-facing) entry of a
+// comma-separated forwarded header, lower-cased and trimmed
+func firstForwardedValue(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.ToLower(strings.TrimSpace(first))
+}
+
+// isValidForwardedHost rejects empty values and anything that could inject a path or userinfo
+func isValidForwardedHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, "/\\@ ?#")
+}
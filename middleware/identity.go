@@ -0,0 +1,18 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// ServedByHeader identifies the replica that served a request
+const ServedByHeader = "X-Served-By"
+
+// ServerIdentityMiddleware adds the X-Served-By response header with the serving pod name.
+// Only enable outside production (EXPOSE_SERVER_IDENTITY=true): pod names leak topology.
+func ServerIdentityMiddleware() gin.HandlerFunc {
+	podName := DetectPodName()
+	return func(c *gin.Context) {
+		if podName != "" {
+			c.Header(ServedByHeader, podName)
+		}
+		c.Next()
+	}
+}
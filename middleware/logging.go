@@ -3,11 +3,15 @@ package middleware
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+
+	"github.com/duynhne/user-service/config"
 )
 
 const TraceIDHeader = "X-Trace-ID"
@@ -64,7 +68,10 @@ func generateTraceID() string {
 }
 
 // LoggingMiddleware creates a Gin middleware for structured logging with trace-id
-func LoggingMiddleware(logger *zap.Logger) gin.HandlerFunc {
+// Access logs for infrastructure paths (see SetExcludedPaths) are demoted to debug
+// level unless logHealthChecks is true (LOG_HEALTH_CHECKS). See SetAccessLogFormat
+// for the optional Combined Log Format line.
+func LoggingMiddleware(logger *zap.Logger, logHealthChecks bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
@@ -76,6 +83,9 @@ func LoggingMiddleware(logger *zap.Logger) gin.HandlerFunc {
 		// Store trace-id in context for handlers to use
 		c.Set("trace_id", traceID)
 
+		// Shared with ServerTimingMiddleware so both report the same duration
+		c.Set(requestStartKey, start)
+
 		// Store logger in context for handlers to use
 		loggerWithTrace := logger.With(zap.String("trace_id", traceID))
 		c.Set("logger", loggerWithTrace)
@@ -90,8 +100,13 @@ func LoggingMiddleware(logger *zap.Logger) gin.HandlerFunc {
 		duration := time.Since(start)
 		statusCode := c.Writer.Status()
 
+		accessLevel, errorLevel := zapcore.InfoLevel, zapcore.ErrorLevel
+		if !logHealthChecks && isExcludedPath(path) {
+			accessLevel, errorLevel = zapcore.DebugLevel, zapcore.DebugLevel
+		}
+
 		// Log request/response
-		logger.Info("HTTP request",
+		logger.Log(accessLevel, "HTTP request",
 			zap.String("trace_id", traceID),
 			zap.String("method", method),
 			zap.String("path", path),
@@ -101,9 +116,15 @@ func LoggingMiddleware(logger *zap.Logger) gin.HandlerFunc {
 			zap.String("user_agent", c.Request.UserAgent()),
 		)
 
+		// Parallel Combined Log Format line (ACCESS_LOG_FORMAT=combined); demoted
+		// infrastructure paths are left out like their info-level JSON entries
+		if accessLevel == zapcore.InfoLevel {
+			writeCombinedLog(c, start)
+		}
+
 		// Log errors (4xx, 5xx) with error level
 		if statusCode >= 400 {
-			logger.Error("HTTP error",
+			logger.Log(errorLevel, "HTTP error",
 				zap.String("trace_id", traceID),
 				zap.String("method", method),
 				zap.String("path", path),
@@ -136,16 +157,43 @@ func GetLoggerFromGinContext(c *gin.Context) *zap.Logger {
 	return logger
 }
 
-// NewLogger creates a new zap logger with JSON encoder for production
+// NewLogger creates a new zap logger with JSON encoder for production at info level.
+// Prefer NewLoggerFromConfig, which honors LOG_LEVEL and LOG_FORMAT.
 func NewLogger() (*zap.Logger, error) {
-	config := zap.NewProductionConfig()
-	config.EncoderConfig.TimeKey = "timestamp"
-	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	config.EncoderConfig.MessageKey = "message"
-	config.EncoderConfig.LevelKey = "level"
-	config.EncoderConfig.CallerKey = "caller"
+	return newLogger("info", "json")
+}
 
-	return config.Build()
+// NewLoggerFromConfig creates the service logger: level from LOG_LEVEL
+// (debug/info/warn/error) and json or console encoding from LOG_FORMAT.
+// Empty values default to info and json; both are checked by Config.Validate.
+func NewLoggerFromConfig(cfg *config.Config) (*zap.Logger, error) {
+	return newLogger(cfg.Logging.Level, cfg.Logging.Format)
+}
+
+func newLogger(level, format string) (*zap.Logger, error) {
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.EncoderConfig.TimeKey = "timestamp"
+	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	zapConfig.EncoderConfig.MessageKey = "message"
+	zapConfig.EncoderConfig.LevelKey = "level"
+	zapConfig.EncoderConfig.CallerKey = "caller"
+
+	if level != "" {
+		lvl, err := zapcore.ParseLevel(strings.ToLower(level))
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		}
+		zapConfig.Level = zap.NewAtomicLevelAt(lvl)
+	}
+	switch strings.ToLower(format) {
+	case "", "json":
+	case "console":
+		zapConfig.Encoding = "console"
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q (want json or console)", format)
+	}
+
+	return zapConfig.Build()
 }
 
 // NewDevelopmentLogger creates a new zap logger for development (console encoder)
@@ -0,0 +1,42 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/duynhne/user-service/config"
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestNewLoggerFromConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		wantLevel zapcore.Level
+		wantErr   bool
+	}{
+		{name: "defaults", wantLevel: zapcore.InfoLevel},
+		{name: "debug json", level: "debug", format: "json", wantLevel: zapcore.DebugLevel},
+		{name: "warn console", level: "WARN", format: "console", wantLevel: zapcore.WarnLevel},
+		{name: "error", level: "error", format: "json", wantLevel: zapcore.ErrorLevel},
+		{name: "unknown level", level: "verbose", format: "json", wantErr: true},
+		{name: "unknown format", level: "info", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Logging: config.LoggingConfig{Level: tt.level, Format: tt.format}}
+			logger, err := middleware.NewLoggerFromConfig(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLoggerFromConfig err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := zapcore.LevelOf(logger.Core()); got != tt.wantLevel {
+				t.Errorf("level = %v, want %v", got, tt.wantLevel)
+			}
+		})
+	}
+}
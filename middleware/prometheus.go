@@ -1,133 +1,233 @@
-package middleware
-
-import (
-	"strconv"
-	"strings"
-	"time"
-
-	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-)
-
-var (
-	requestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "request_duration_seconds",
-			Help:    "Duration of HTTP requests in seconds",
-			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
-		},
-		[]string{"method", "path", "code"},
-	)
-
-	requestTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "path", "code"},
-	)
-
-	requestsInFlight = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "requests_in_flight",
-			Help: "Number of HTTP requests currently being processed",
-		},
-		[]string{"method", "path"},
-	)
-
-	requestSize = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "request_size_bytes",
-			Help:    "Size of HTTP requests in bytes",
-			Buckets: []float64{100, 1000, 10000, 100000, 1000000},
-		},
-		[]string{"method", "path", "code"},
-	)
-
-	responseSize = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "response_size_bytes",
-			Help:    "Size of HTTP responses in bytes",
-			Buckets: []float64{100, 1000, 10000, 100000, 1000000},
-		},
-		[]string{"method", "path", "code"},
-	)
-
-	errorRate = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "error_rate_total",
-			Help: "Total number of HTTP errors",
-		},
-		[]string{"method", "path", "code"},
-	)
-)
-
-// shouldCollectMetrics determines if metrics should be collected for a given path
-// Infrastructure endpoints (health checks, metrics) are excluded to prevent:
-// - High cardinality in Prometheus (millions of /health datapoints)
-// - Skewed metrics (79% of traffic was health checks in k6 tests)
-// - Storage waste (infrastructure traffic has no business value)
-func shouldCollectMetrics(path string) bool {
-	// Skip infrastructure endpoints
-	infrastructurePaths := []string{
-		"/health",
-		"/ready",
-		"/metrics",
-		"/readiness",
-		"/liveness",
-	}
-
-	for _, skipPath := range infrastructurePaths {
-		if strings.HasPrefix(path, skipPath) {
-			return false
-		}
-	}
-
-	return true
-}
-
-func PrometheusMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-
-		method := c.Request.Method
-		path := c.Request.URL.Path
-
-		// Skip metrics collection for infrastructure endpoints
-		// These are handled by Kubernetes probes and monitoring systems
-		// Not representative of actual user/business traffic
-		if !shouldCollectMetrics(path) {
-			c.Next()
-			return
-		}
-
-		// Increment in-flight requests
-		requestsInFlight.WithLabelValues(method, path).Inc()
-
-		// Record request size
-		requestSize.WithLabelValues(method, path, "").Observe(float64(c.Request.ContentLength))
-
-		// Process request
-		c.Next()
-
-		// Calculate duration
-		duration := time.Since(start).Seconds()
-		statusCode := strconv.Itoa(c.Writer.Status())
-
-		// Record metrics
-		requestDuration.WithLabelValues(method, path, statusCode).Observe(duration)
-		requestTotal.WithLabelValues(method, path, statusCode).Inc()
-
-		// Record response size
-		responseSize.WithLabelValues(method, path, statusCode).Observe(float64(c.Writer.Size()))
-
-		// Record errors (5xx)
-		if c.Writer.Status() >= 500 {
-			errorRate.WithLabelValues(method, path, statusCode).Inc()
-		}
-
-		// Decrement in-flight requests
-		requestsInFlight.WithLabelValues(method, path).Dec()
-	}
-}
+package middleware
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultDurationBuckets resolve latencies from 1ms up to 5s, tuned for a fast
+// service whose p99 sits well under 50ms.
+var DefaultDurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+var (
+	// requestDuration is registered by InitDurationMetric so its buckets can be configured
+	requestDuration     *prometheus.HistogramVec
+	requestDurationOnce sync.Once
+)
+
+// InitDurationMetric registers request_duration_seconds with the given buckets
+// (METRICS_DURATION_BUCKETS); empty buckets select DefaultDurationBuckets.
+// Only the first call takes effect; call it before PrometheusMiddleware.
+func InitDurationMetric(buckets []float64) {
+	requestDurationOnce.Do(func() {
+		if len(buckets) == 0 {
+			buckets = DefaultDurationBuckets
+		}
+		requestDuration = promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "request_duration_seconds",
+				Help:    "Duration of HTTP requests in seconds",
+				Buckets: buckets,
+			},
+			[]string{"method", "path", "code"},
+		)
+	})
+}
+
+var (
+	requestTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "requests_total",
+			Help: "Total number of HTTP requests",
+		},
+		[]string{"method", "path", "code"},
+	)
+
+	requestsInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "requests_in_flight",
+			Help: "Number of HTTP requests currently being processed",
+		},
+		[]string{"method", "path"},
+	)
+
+	requestSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "request_size_bytes",
+			Help:    "Size of HTTP requests in bytes",
+			Buckets: []float64{100, 1000, 10000, 100000, 1000000},
+		},
+		[]string{"method", "path", "code"},
+	)
+
+	responseSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "response_size_bytes",
+			Help:    "Size of HTTP responses in bytes",
+			Buckets: []float64{100, 1000, 10000, 100000, 1000000},
+		},
+		[]string{"method", "path", "code"},
+	)
+
+	errorRate = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "error_rate_total",
+			Help: "Total number of HTTP errors",
+		},
+		[]string{"method", "path", "code"},
+	)
+
+	requestDecodeErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "request_decode_errors_total",
+			Help: "Total number of request bodies that failed JSON decoding or validation",
+		},
+		[]string{"endpoint"},
+	)
+
+	authCacheHits = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "auth_cache_hits_total",
+			Help: "Total number of auth token cache hits",
+		},
+	)
+
+	authCacheMisses = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "auth_cache_misses_total",
+			Help: "Total number of auth token cache misses",
+		},
+	)
+
+	authFallbackTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_fallback_total",
+			Help: "Total number of requests served as the demo user by the unauthenticated fallback",
+		},
+		[]string{"reason"},
+	)
+
+	userOperations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "user_operations_total",
+			Help: "Successful profile writes by operation and outcome",
+		},
+		[]string{"operation", "outcome"},
+	)
+
+	authCacheSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "auth_cache_size",
+			Help: "Number of entries currently held in the auth token cache",
+		},
+	)
+
+	shutdownInProgress = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "shutdown_in_progress",
+			Help: "1 while the service is draining for shutdown, 0 otherwise",
+		},
+	)
+
+	lastRequestCompleted = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "last_request_completed_timestamp_seconds",
+			Help: "Unix time at which the last business HTTP request completed",
+		},
+	)
+)
+
+// SetShutdownInProgress records whether the graceful drain has started
+// (call wherever the readiness flag flips)
+func SetShutdownInProgress(inProgress bool) {
+	if inProgress {
+		shutdownInProgress.Set(1)
+		return
+	}
+	shutdownInProgress.Set(0)
+}
+
+// RecordDecodeError counts a request body that failed binding for the given endpoint
+// (use the route template, e.g. c.FullPath(), to keep cardinality bounded)
+func RecordDecodeError(endpoint string) {
+	requestDecodeErrors.WithLabelValues(endpoint).Inc()
+}
+
+// User operation outcomes recorded in user_operations_total
+const (
+	UserOutcomeCreated     = "created"      // explicit creation (CreateUser)
+	UserOutcomeAutoCreated = "auto_created" // lazy creation by UpdateProfile
+	UserOutcomeUpdated     = "updated"      // edit of an existing profile
+	UserOutcomeExisting    = "existing"     // CreateUser ?upsert=true found a profile
+)
+
+// RecordUserOperation counts a successful profile write, e.g.
+// RecordUserOperation("update_profile", UserOutcomeAutoCreated)
+func RecordUserOperation(operation, outcome string) {
+	userOperations.WithLabelValues(operation, outcome).Inc()
+}
+
+// shouldCollectMetrics determines if metrics should be collected for a given path
+// Infrastructure endpoints (health checks, metrics) are excluded to prevent:
+// - High cardinality in Prometheus (millions of /health datapoints)
+// - Skewed metrics (79% of traffic was health checks in k6 tests)
+// - Storage waste (infrastructure traffic has no business value)
+// The exclusion list is shared with tracing (see SetExcludedPaths).
+func shouldCollectMetrics(path string) bool {
+	return !isExcludedPath(path) && !isMetricsOnlyExcludedPath(path)
+}
+
+func PrometheusMiddleware() gin.HandlerFunc {
+	InitDurationMetric(nil)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		method := c.Request.Method
+		path := c.Request.URL.Path
+
+		// Skip metrics collection for infrastructure endpoints
+		// These are handled by Kubernetes probes and monitoring systems
+		// Not representative of actual user/business traffic
+		if !shouldCollectMetrics(path) {
+			c.Next()
+			return
+		}
+
+		// Increment in-flight requests
+		requestsInFlight.WithLabelValues(method, path).Inc()
+
+		// Record request size
+		requestSize.WithLabelValues(method, path, "").Observe(float64(c.Request.ContentLength))
+
+		// Process request
+		c.Next()
+
+		// Calculate duration
+		duration := time.Since(start).Seconds()
+		statusCode := strconv.Itoa(c.Writer.Status())
+
+		// Record metrics
+		requestDuration.WithLabelValues(method, path, statusCode).Observe(duration)
+		requestTotal.WithLabelValues(method, path, statusCode).Inc()
+
+		// Record response size
+		responseSize.WithLabelValues(method, path, statusCode).Observe(float64(c.Writer.Size()))
+
+		// Record errors (5xx)
+		if c.Writer.Status() >= 500 {
+			errorRate.WithLabelValues(method, path, statusCode).Inc()
+		}
+
+		// Decrement in-flight requests
+		requestsInFlight.WithLabelValues(method, path).Dec()
+
+		// Lets incident reviews confirm traffic drained before the server stopped
+		lastRequestCompleted.SetToCurrentTime()
+	}
+}
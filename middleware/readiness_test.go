@@ -0,0 +1,142 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("down") }
+
+	tests := []struct {
+		name         string
+		shuttingDown bool
+		checks       []middleware.ReadinessCheck
+		wantStatus   int
+		wantBody     string
+		wantChecks   map[string]string
+	}{
+		{
+			name: "all ok",
+			checks: []middleware.ReadinessCheck{
+				{Name: "db", Required: true, Check: ok},
+				{Name: "auth", Check: ok},
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+			wantChecks: map[string]string{"db": "ok", "auth": "ok"},
+		},
+		{
+			name: "optional check failing",
+			checks: []middleware.ReadinessCheck{
+				{Name: "db", Required: true, Check: ok},
+				{Name: "auth", Check: fail},
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "degraded",
+			wantChecks: map[string]string{"db": "ok", "auth": "fail"},
+		},
+		{
+			name: "required check failing",
+			checks: []middleware.ReadinessCheck{
+				{Name: "db", Required: true, Check: fail},
+				{Name: "auth", Check: ok},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "unavailable",
+			wantChecks: map[string]string{"db": "fail", "auth": "ok"},
+		},
+		{
+			name:         "shutting down skips checks",
+			shuttingDown: true,
+			checks:       []middleware.ReadinessCheck{{Name: "db", Required: true, Check: ok}},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantBody:     "shutting_down",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var shuttingDown atomic.Bool
+			shuttingDown.Store(tt.shuttingDown)
+			t.Cleanup(func() { middleware.SetShutdownInProgress(false) })
+
+			r := gin.New()
+			r.GET("/ready", middleware.ReadinessHandler(zap.NewNop(), &shuttingDown, tt.checks))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/ready", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+				t.Error("503 without Retry-After")
+			}
+			var body struct {
+				Status string            `json:"status"`
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Status != tt.wantBody {
+				t.Errorf("body status = %q, want %q", body.Status, tt.wantBody)
+			}
+			if !reflect.DeepEqual(body.Checks, tt.wantChecks) {
+				t.Errorf("checks = %v, want %v", body.Checks, tt.wantChecks)
+			}
+		})
+	}
+}
+
+func TestCachedCheck(t *testing.T) {
+	var calls atomic.Int32
+	check := middleware.CachedCheck(time.Hour, func(context.Context) error {
+		calls.Add(1)
+		return errors.New("down")
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if err := check(context.Background()); err == nil {
+				t.Error("cached check lost the failure")
+			}
+		})
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check ran %d times, want 1 within the TTL", n)
+	}
+
+	t.Run("canceled caller is not cached", func(t *testing.T) {
+		calls.Store(0)
+		check := middleware.CachedCheck(time.Hour, func(ctx context.Context) error {
+			calls.Add(1)
+			return ctx.Err()
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_ = check(ctx)
+		if err := check(context.Background()); err != nil {
+			t.Errorf("err = %v, want the fresh result", err)
+		}
+		if n := calls.Load(); n != 2 {
+			t.Errorf("check ran %d times, want 2", n)
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 
 	"fmt"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
@@ -14,8 +15,8 @@ import (
 // unknownService is the default service name when detection fails
 const unknownService = "unknown-service"
 
-// detectServiceInfo automatically detects service name and namespace from Kubernetes environment
-// This function uses multiple detection methods with fallback priority:
+// detectServiceInfo automatically detects service name and namespace (see detectNamespace)
+// from the Kubernetes environment. The service name uses fallback priority:
 // 1. OTEL_SERVICE_NAME env var (highest priority)
 // 2. POD_NAME extraction (strip deployment hash)
 // 3. Hostname extraction (for Kubernetes pods)
@@ -26,33 +27,7 @@ func detectServiceInfo() (serviceName, namespace string) {
 
 	// If not set, try to extract from Kubernetes pod name
 	if serviceName == "" {
-		// Try POD_NAME env var (if injected via Downward API)
-		podName := os.Getenv("POD_NAME")
-		if podName == "" {
-			// Fallback to hostname (Kubernetes sets this to pod name)
-			podName, _ = os.Hostname()
-		}
-
-		// Extract service name from pod name pattern
-		// Kubernetes pod naming: <deployment-name>-<replicaset-hash>-<pod-hash>
-		// Examples:
-		//   "auth-75c98b4b9c-kdv2n" -> "auth"
-		//   "shipping-v2-6dd695b778-7p4gz" -> "shipping-v2"
-		//   "user-service-abc123-xyz456" -> "user-service"
-		//
-		// Strategy: Remove last 2 parts (replicaset-hash and pod-hash)
-		// - Replicaset hash: 10 chars (e.g., "75c98b4b9c")
-		// - Pod hash: 5 chars (e.g., "kdv2n")
-		if podName != "" {
-			parts := strings.Split(podName, "-")
-			if len(parts) >= 3 {
-				// Remove last 2 parts (hashes), keep everything before
-				serviceName = strings.Join(parts[:len(parts)-2], "-")
-			} else if len(parts) > 0 {
-				// Fallback to first part if pattern doesn't match
-				serviceName = parts[0]
-			}
-		}
+		serviceName = serviceNameFromPodName(DetectPodName())
 	}
 
 	// Fallback if still empty
@@ -60,40 +35,111 @@ func detectServiceInfo() (serviceName, namespace string) {
 		serviceName = unknownService
 	}
 
-	// Detect namespace
-	// 1. OTEL_RESOURCE_ATTRIBUTES (e.g., "service.namespace=production")
+	return serviceName, detectNamespace()
+}
+
+// serviceAccountNamespaceFile is mounted into every Kubernetes pod with a service account
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// detectNamespace resolves service.namespace with fallback priority:
+// 1. SERVICE_NAMESPACE env var (explicit override, e.g. bare metal or local runs)
+// 2. OTEL_RESOURCE_ATTRIBUTES (e.g., "service.namespace=production")
+// 3. Kubernetes service account namespace file
+// 4. POD_NAMESPACE env var (if injected via Downward API)
+// 5. "default" when running in Kubernetes (KUBERNETES_SERVICE_HOST is set),
+// otherwise "" so non-Kubernetes deployments are not mislabeled
+func detectNamespace() string {
+	if ns := os.Getenv("SERVICE_NAMESPACE"); ns != "" {
+		return ns
+	}
+
 	if attrs := os.Getenv("OTEL_RESOURCE_ATTRIBUTES"); attrs != "" {
 		for _, attr := range strings.Split(attrs, ",") {
 			kv := strings.SplitN(attr, "=", 2)
 			if len(kv) == 2 && kv[0] == "service.namespace" {
-				namespace = kv[1]
-				return serviceName, namespace
+				return kv[1]
 			}
 		}
 	}
 
-	// 2. Read from Kubernetes service account namespace file
-	// This file is automatically mounted by Kubernetes
-	if data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
-		namespace = strings.TrimSpace(string(data))
-		return serviceName, namespace
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(data))
 	}
 
-	// 3. POD_NAMESPACE env var (if injected via Downward API)
 	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
-		namespace = ns
-		return serviceName, namespace
+		return ns
+	}
+
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "default"
+	}
+	return ""
+}
+
+// serviceNameFromPodName derives the workload name from a Kubernetes pod name
+//
+// Naming patterns:
+//   - StatefulSet: <statefulset-name>-<ordinal>, e.g. "my-app-0" -> "my-app"
+//   - Deployment: <deployment-name>-<replicaset-hash>-<pod-hash>, e.g.
+//     "auth-75c98b4b9c-kdv2n" -> "auth", "shipping-v2-6dd695b778-7p4gz" -> "shipping-v2"
+//   - Anything else (bare hostnames): the name itself, e.g. "my-app" -> "my-app"
+func serviceNameFromPodName(podName string) string {
+	if podName == "" {
+		return ""
+	}
+	parts := strings.Split(podName, "-")
+
+	// StatefulSet ordinal suffix: strip only the numeric last part
+	if len(parts) >= 2 && isNumeric(parts[len(parts)-1]) {
+		return strings.Join(parts[:len(parts)-1], "-")
+	}
+
+	// Deployment: remove last 2 parts (replicaset hash and pod hash)
+	if len(parts) >= 3 {
+		return strings.Join(parts[:len(parts)-2], "-")
 	}
 
-	// Fallback
-	namespace = "default"
-	return serviceName, namespace
+	// Bare names (hostnames, single-dash workload names) are used as-is
+	return podName
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// DetectPodName returns the pod name from POD_NAME (Downward API),
+// falling back to the hostname (Kubernetes sets this to the pod name)
+func DetectPodName() string {
+	if podName := os.Getenv("POD_NAME"); podName != "" {
+		return podName
+	}
+	hostname, _ := os.Hostname()
+	return hostname
 }
 
 // CreateResource creates an OpenTelemetry resource with auto-detected attributes
 // This function is exported for use by other middleware (tracing, profiling)
+// k8s.pod.name (DetectPodName) lets traces be filtered down to a single replica.
 func CreateResource(ctx context.Context) (*resource.Resource, error) {
 	serviceName, namespace := detectServiceInfo()
+	identity := []attribute.KeyValue{
+		// Service identification (these will override if detection finds them)
+		semconv.ServiceNameKey.String(serviceName),
+	}
+	if namespace != "" {
+		identity = append(identity, semconv.ServiceNamespaceKey.String(namespace))
+	}
+	if podName := DetectPodName(); podName != "" {
+		identity = append(identity, semconv.K8SPodNameKey.String(podName))
+	}
 
 	// Create resource with detected attributes
 	res, err := resource.New(
@@ -103,25 +149,38 @@ func CreateResource(ctx context.Context) (*resource.Resource, error) {
 		resource.WithOS(),        // Add OS info
 		resource.WithContainer(), // Add container ID if running in container
 		resource.WithHost(),      // Add hostname
-		resource.WithAttributes(
-			// Service identification (these will override if detection finds them)
-			semconv.ServiceNameKey.String(serviceName),
-			semconv.ServiceNamespaceKey.String(namespace),
-		),
+		resource.WithAttributes(identity...),
 	)
 
 	if err != nil {
 		// If resource creation fails, create minimal resource
-		return resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(serviceName),
-			semconv.ServiceNamespaceKey.String(namespace),
-		), fmt.Errorf("resource detection partial failure (using fallback): %w", err)
+		return resource.NewWithAttributes(semconv.SchemaURL, identity...), fmt.Errorf("resource detection partial failure (using fallback): %w", err)
 	}
 
 	return res, nil
 }
 
+// detectedResourceKeys are attributes normally filled by CreateResource detectors
+var detectedResourceKeys = []attribute.Key{
+	semconv.HostNameKey,
+	semconv.OSTypeKey,
+	semconv.ProcessPIDKey,
+	semconv.ContainerIDKey,
+}
+
+// MissingResourceAttributes lists detector attributes absent from res, i.e. the
+// ones left out (defaulted) when detection partially failed.
+// container.id is expected to be missing outside containers.
+func MissingResourceAttributes(res *resource.Resource) []string {
+	var missing []string
+	for _, key := range detectedResourceKeys {
+		if _, ok := res.Set().Value(key); !ok {
+			missing = append(missing, string(key))
+		}
+	}
+	return missing
+}
+
 // GetServiceName extracts service name from a resource
 func GetServiceName(res *resource.Resource) string {
 	for _, attr := range res.Attributes() {
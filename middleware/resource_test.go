@@ -0,0 +1,87 @@
+package middleware_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestCreateResourceNamespace(t *testing.T) {
+	_, inCluster := os.Stat("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+
+	tests := []struct {
+		name             string
+		serviceNamespace string
+		k8sHost          string
+		podNamespace     string
+		want             string // "" = service.namespace absent
+		needsNoK8sFile   bool
+	}{
+		{name: "override wins", serviceNamespace: "edge", podNamespace: "shop", want: "edge"},
+		{name: "pod namespace", podNamespace: "shop", want: "shop", needsNoK8sFile: true},
+		{name: "kubernetes fallback", k8sHost: "10.0.0.1", want: "default", needsNoK8sFile: true},
+		{name: "not kubernetes", want: "", needsNoK8sFile: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.needsNoK8sFile && inCluster == nil {
+				t.Skip("service account namespace file present (running in Kubernetes)")
+			}
+			t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "")
+			t.Setenv("SERVICE_NAMESPACE", tt.serviceNamespace)
+			t.Setenv("KUBERNETES_SERVICE_HOST", tt.k8sHost)
+			t.Setenv("POD_NAMESPACE", tt.podNamespace)
+
+			// Partial detector failures still return a usable resource
+			res, _ := middleware.CreateResource(context.Background())
+			got, ok := res.Set().Value(semconv.ServiceNamespaceKey)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("service.namespace = %q, want absent", got.AsString())
+				}
+				return
+			}
+			if got.AsString() != tt.want {
+				t.Errorf("service.namespace = %q, want %q", got.AsString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateResourceServiceName(t *testing.T) {
+	tests := []struct {
+		name            string
+		otelServiceName string
+		podName         string
+		want            string
+	}{
+		{name: "statefulset", podName: "my-app-0", want: "my-app"},
+		{name: "statefulset two-digit ordinal", podName: "my-app-12", want: "my-app"},
+		{name: "deployment", podName: "my-app-7d9f8-abcde", want: "my-app"},
+		{name: "deployment single word", podName: "auth-75c98b4b9c-kdv2n", want: "auth"},
+		{name: "bare name", podName: "my-app", want: "my-app"},
+		{name: "bare hostname", podName: "devbox", want: "devbox"},
+		{
+			name:            "override wins over pod name",
+			otelServiceName: "checkout",
+			podName:         "my-app-0",
+			want:            "checkout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "")
+			t.Setenv("OTEL_SERVICE_NAME", tt.otelServiceName)
+			t.Setenv("POD_NAME", tt.podName)
+
+			res, _ := middleware.CreateResource(context.Background())
+			if got := middleware.GetServiceName(res); got != tt.want {
+				t.Errorf("service.name for POD_NAME=%q = %q, want %q", tt.podName, got, tt.want)
+			}
+		})
+	}
+}
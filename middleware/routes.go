@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigureFallbackRoutes makes unmatched requests answer with JSON instead of
+// gin's plain-text/HTML defaults.
+//
+// Trailing slashes are not redirected: "/api/v1/users/profile/" is a distinct,
+// unregistered path and returns a JSON 404 rather than a 301/307 to the
+// slash-less route. Redirects would drop Authorization on some clients and turn
+// PUT bodies into GETs, so callers must use the canonical path.
+func ConfigureFallbackRoutes(r *gin.Engine) {
+	r.RedirectTrailingSlash = false
+	r.RedirectFixedPath = false
+	r.HandleMethodNotAllowed = true
+
+	r.NoRoute(func(c *gin.Context) {
+		body := ErrorBody(CodeNotFound, "Not found")
+		body["trace_id"] = c.GetString("trace_id")
+		c.JSON(http.StatusNotFound, body)
+	})
+	r.NoMethod(func(c *gin.Context) {
+		body := ErrorBody(CodeMethodNotAllowed, "Method not allowed")
+		body["trace_id"] = c.GetString("trace_id")
+		c.JSON(http.StatusMethodNotAllowed, body)
+	})
+}
+
+// rootResponse is the GET / service descriptor
+type rootResponse struct {
+	Service   string   `json:"service"`
+	Version   string   `json:"version"`
+	Status    string   `json:"status"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// RootHandler serves GET / with a small JSON descriptor so probes and operators
+// hitting the bare host get something useful instead of a 404. endpoints are
+// listed as "METHOD /path". "/" is excluded from tracing and metrics like
+// /health (see exactExcludedPaths).
+func RootHandler(service, version string, endpoints []string) gin.HandlerFunc {
+	body := rootResponse{Service: service, Version: version, Status: "ok", Endpoints: endpoints}
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, body)
+	}
+}
@@ -0,0 +1,93 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestConfigureFallbackRoutesTrailingSlash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	middleware.ConfigureFallbackRoutes(r)
+	r.GET("/api/v1/users/profile", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantCode   string // error envelope code ("" for success)
+	}{
+		{name: "canonical path", method: http.MethodGet, path: "/api/v1/users/profile", wantStatus: http.StatusOK},
+		{
+			name: "trailing slash", method: http.MethodGet, path: "/api/v1/users/profile/",
+			wantStatus: http.StatusNotFound, wantCode: "not_found",
+		},
+		{
+			name: "wrong case", method: http.MethodGet, path: "/API/v1/users/profile",
+			wantStatus: http.StatusNotFound, wantCode: "not_found",
+		},
+		{
+			name: "wrong method", method: http.MethodDelete, path: "/api/v1/users/profile",
+			wantStatus: http.StatusMethodNotAllowed, wantCode: "method_not_allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, http.NoBody))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body=%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if loc := w.Header().Get("Location"); loc != "" {
+				t.Errorf("unexpected redirect to %q", loc)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not JSON: %v (body=%q)", err, w.Body.String())
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			if body["code"] != tt.wantCode {
+				t.Errorf("code = %v, want %q", body["code"], tt.wantCode)
+			}
+			if _, ok := body["trace_id"]; !ok {
+				t.Error("error body has no trace_id")
+			}
+		})
+	}
+}
+
+func TestRootHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	middleware.ConfigureFallbackRoutes(r)
+	r.GET("/", middleware.RootHandler("user", "1.2.3", []string{"GET /health"}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body=%s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v (body=%q)", err, w.Body.String())
+	}
+	want := map[string]any{
+		"service": "user", "version": "1.2.3", "status": "ok", "endpoints": []any{"GET /health"},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("body = %v, want %v", body, want)
+	}
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServerTimingHeader is the W3C Server-Timing response header
+const ServerTimingHeader = "Server-Timing"
+
+// requestStartKey is the gin context key holding the request start time set by LoggingMiddleware
+const requestStartKey = "request_start"
+
+type serverTimingKey struct{}
+
+// serverTiming accumulates phase durations for one request
+type serverTiming struct {
+	dbNanos atomic.Int64
+}
+
+// RecordDBTime adds d to the request's "db" Server-Timing phase.
+// No-op when ServerTimingMiddleware is not installed for the request.
+func RecordDBTime(ctx context.Context, d time.Duration) {
+	if st, ok := ctx.Value(serverTimingKey{}).(*serverTiming); ok {
+		st.dbNanos.Add(int64(d))
+	}
+}
+
+// ServerTimingMiddleware adds a Server-Timing header with the total handler
+// duration and, when measured, the time spent in DB queries:
+//
+//	Server-Timing: db;dur=3.2, total;dur=12.5
+//
+// The total uses the same start time as LoggingMiddleware (register it after
+// LoggingMiddleware). Enabled by SERVER_TIMING_ENABLED.
+func ServerTimingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		if v, ok := c.Get(requestStartKey); ok {
+			if t, ok := v.(time.Time); ok {
+				start = t
+			}
+		}
+
+		st := &serverTiming{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), serverTimingKey{}, st))
+		c.Writer = &serverTimingWriter{ResponseWriter: c.Writer, start: start, timing: st}
+		c.Next()
+	}
+}
+
+// serverTimingWriter sets Server-Timing right before the headers are flushed,
+// since headers cannot change once the handler has written the body.
+type serverTimingWriter struct {
+	gin.ResponseWriter
+	start   time.Time
+	timing  *serverTiming
+	written bool
+}
+
+func (w *serverTimingWriter) setHeader() {
+	if w.written {
+		return
+	}
+	w.written = true
+	total := time.Since(w.start)
+	value := fmt.Sprintf("total;dur=%.1f", float64(total.Microseconds())/1000)
+	if db := time.Duration(w.timing.dbNanos.Load()); db > 0 {
+		value = fmt.Sprintf("db;dur=%.1f, %s", float64(db.Microseconds())/1000, value)
+	}
+	w.Header().Set(ServerTimingHeader, value)
+}
+
+func (w *serverTimingWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serverTimingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *serverTimingWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *serverTimingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,52 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestServerTimingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.LoggingMiddleware(zap.NewNop(), false))
+	r.Use(middleware.ServerTimingMiddleware())
+	r.GET("/plain", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	r.GET("/db", func(c *gin.Context) {
+		middleware.RecordDBTime(c.Request.Context(), 2*time.Millisecond)
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		wantDB bool
+	}{
+		{name: "total only", path: "/plain", wantDB: false},
+		{name: "with db phase", path: "/db", wantDB: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.path, nil)
+			r.ServeHTTP(w, req)
+
+			header := w.Header().Get(middleware.ServerTimingHeader)
+			if !strings.Contains(header, "total;dur=") {
+				t.Fatalf("Server-Timing = %q, want total phase", header)
+			}
+			if got := strings.Contains(header, "db;dur=2.0"); got != tt.wantDB {
+				t.Errorf("Server-Timing = %q, db phase present = %v, want %v", header, got, tt.wantDB)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Shutdowner is a component stopped with a deadline: *http.Server, *Supervisor,
+// the tracer provider.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// GracefulShutdown is the ordered stop sequence run after SIGTERM:
+//
+//  1. readiness fails (ShuttingDown) so the load balancer stops routing here
+//  2. DrainDelay passes so endpoints are removed before connections are refused
+//  3. Server (then AdminServer) stops accepting and drains in-flight requests
+//  4. Workers stop, before the pools they read from are closed
+//  5. Pool closes
+//  6. Tracer flushes and stops
+//  7. Profiler stops (bounded by ProfilerTimeout)
+//
+// Steps 3-6 share one Timeout deadline. Optional components may be nil.
+type GracefulShutdown struct {
+	Logger       *zap.Logger
+	ShuttingDown *atomic.Bool // read by ReadinessHandler
+	DrainDelay   time.Duration
+	Timeout      time.Duration
+
+	Server      Shutdowner
+	AdminServer Shutdowner // optional (ADMIN_PORT)
+	Workers     Shutdowner
+	Pool        interface{ Close() }
+	Tracer      Shutdowner // optional (tracing disabled)
+
+	// StopProfiler is optional (profiling disabled); see StopProfiling
+	StopProfiler    func(ctx context.Context) error
+	ProfilerTimeout time.Duration
+
+	// Drain waits out the drain window; nil sleeps for DrainDelay
+	Drain func(d time.Duration)
+}
+
+// Run executes the shutdown sequence. Failures are logged and do not stop
+// later steps, so the pool and tracer are released even if draining times out.
+func (g *GracefulShutdown) Run() {
+	logger := g.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	g.ShuttingDown.Store(true)
+	SetShutdownInProgress(true)
+	if g.DrainDelay > 0 {
+		logger.Info("Readiness drain delay started", zap.Duration("delay", g.DrainDelay))
+		drain := g.Drain
+		if drain == nil {
+			drain = time.Sleep
+		}
+		drain(g.DrainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+
+	logger.Info("Shutting down server...", zap.Duration("timeout", g.Timeout))
+
+	if err := g.Server.Shutdown(ctx); err != nil {
+		logger.Error("HTTP server shutdown error", zap.Error(err))
+	} else {
+		logger.Info("HTTP server shutdown complete")
+	}
+	// The admin server stops last so metrics stay scrapeable while requests drain
+	if g.AdminServer != nil {
+		if err := g.AdminServer.Shutdown(ctx); err != nil {
+			logger.Error("Admin server shutdown error", zap.Error(err))
+		} else {
+			logger.Info("Admin server shutdown complete")
+		}
+	}
+
+	// Stop background goroutines before closing the pools they read from
+	if err := g.Workers.Shutdown(ctx); err != nil {
+		logger.Error("Background goroutines shutdown error", zap.Error(err))
+	} else {
+		logger.Info("Background goroutines stopped")
+	}
+
+	g.Pool.Close()
+	logger.Info("Database pools closed")
+
+	if g.Tracer != nil {
+		if err := g.Tracer.Shutdown(ctx); err != nil {
+			logger.Error("Tracer shutdown error", zap.Error(err))
+		} else {
+			logger.Info("Tracer shutdown complete")
+		}
+	}
+
+	if g.StopProfiler != nil {
+		profilerCtx, profilerCancel := context.WithTimeout(context.Background(), g.ProfilerTimeout)
+		if err := g.StopProfiler(profilerCtx); err != nil {
+			logger.Error("Profiler shutdown error",
+				zap.Error(err),
+				zap.Duration("timeout", g.ProfilerTimeout),
+			)
+		} else {
+			logger.Info("Profiler shutdown complete")
+		}
+		profilerCancel()
+	}
+
+	logger.Info("Graceful shutdown complete")
+}
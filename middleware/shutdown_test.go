@@ -0,0 +1,117 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+// shutdownRecorder records the order in which shutdown steps run
+type shutdownRecorder struct {
+	steps []string
+}
+
+func (r *shutdownRecorder) step(name string, err error) *fakeShutdowner {
+	return &fakeShutdowner{name: name, err: err, rec: r}
+}
+
+type fakeShutdowner struct {
+	name string
+	err  error
+	rec  *shutdownRecorder
+}
+
+func (f *fakeShutdowner) Shutdown(context.Context) error {
+	f.rec.steps = append(f.rec.steps, f.name)
+	return f.err
+}
+
+func (f *fakeShutdowner) Close() {
+	f.rec.steps = append(f.rec.steps, f.name)
+}
+
+func TestGracefulShutdownOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var shuttingDown atomic.Bool
+	r := gin.New()
+	r.GET("/ready", middleware.ReadinessHandler(nil, &shuttingDown, []middleware.ReadinessCheck{{
+		Name:     middleware.ReadinessCheckDB,
+		Required: true,
+		Check:    func(context.Context) error { return nil },
+	}}))
+
+	ready := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", http.NoBody))
+		return w.Code
+	}
+	if got := ready(); got != http.StatusOK {
+		t.Fatalf("readiness before shutdown = %d, want %d", got, http.StatusOK)
+	}
+
+	rec := &shutdownRecorder{}
+	shutdown := &middleware.GracefulShutdown{
+		ShuttingDown: &shuttingDown,
+		DrainDelay:   time.Second,
+		Timeout:      time.Second,
+		Server:       rec.step("http", nil),
+		AdminServer:  rec.step("admin", nil),
+		// A failing step must not stop the rest of the sequence
+		Workers: rec.step("workers", errors.New("timed out")),
+		Pool:    rec.step("pool", nil),
+		Tracer:  rec.step("tracer", nil),
+		StopProfiler: func(context.Context) error {
+			rec.steps = append(rec.steps, "profiler")
+			return nil
+		},
+		Drain: func(d time.Duration) {
+			if d != time.Second {
+				t.Errorf("drain delay = %v, want %v", d, time.Second)
+			}
+			if got := ready(); got != http.StatusServiceUnavailable {
+				t.Errorf("readiness during drain = %d, want %d", got, http.StatusServiceUnavailable)
+			}
+			rec.steps = append(rec.steps, "drain")
+		},
+	}
+	shutdown.Run()
+	t.Cleanup(func() { middleware.SetShutdownInProgress(false) })
+
+	want := []string{"drain", "http", "admin", "workers", "pool", "tracer", "profiler"}
+	if !slices.Equal(rec.steps, want) {
+		t.Errorf("shutdown steps = %v, want %v", rec.steps, want)
+	}
+}
+
+func TestGracefulShutdownOptionalSteps(t *testing.T) {
+	var shuttingDown atomic.Bool
+	rec := &shutdownRecorder{}
+	shutdown := &middleware.GracefulShutdown{
+		ShuttingDown: &shuttingDown,
+		Timeout:      time.Second,
+		Server:       rec.step("http", nil),
+		Workers:      rec.step("workers", nil),
+		Pool:         rec.step("pool", nil),
+		Drain: func(time.Duration) {
+			t.Error("drain ran without a drain delay")
+		},
+	}
+	shutdown.Run()
+	t.Cleanup(func() { middleware.SetShutdownInProgress(false) })
+
+	if !shuttingDown.Load() {
+		t.Error("readiness was not failed")
+	}
+	if want := []string{"http", "workers", "pool"}; !slices.Equal(rec.steps, want) {
+		t.Errorf("shutdown steps = %v, want %v", rec.steps, want)
+	}
+}
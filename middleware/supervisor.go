@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Supervisor runs background goroutines (metric sampling, cache refresh, event
+// publishing) under one cancellable context and tracks them in a WaitGroup so
+// shutdown can wait for them instead of leaking them.
+//
+// Usage:
+//
+//	sup := middleware.NewSupervisor(logger)
+//	sup.Go("db_pool_stats", func(ctx context.Context) {
+//	    database.RunPoolStatsSampler(ctx, pools, interval)
+//	})
+//	...
+//	_ = sup.Shutdown(shutdownCtx)
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger *zap.Logger
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]int // goroutine name -> live instances
+}
+
+// NewSupervisor creates a Supervisor; logger may be nil
+func NewSupervisor(logger *zap.Logger) *Supervisor {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{
+		ctx:     ctx,
+		cancel:  cancel,
+		logger:  logger,
+		running: make(map[string]int),
+	}
+}
+
+// Go starts fn in a tracked goroutine. fn must return once ctx is done; a
+// panic is recovered and logged so one worker cannot take the process down.
+// Calls after Shutdown has started are ignored.
+func (s *Supervisor) Go(name string, fn func(ctx context.Context)) {
+	// Checked under mu so no goroutine is added once Shutdown is waiting
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		s.logger.Warn("Supervisor is shutting down, goroutine not started", zap.String("goroutine", name))
+		return
+	}
+	s.running[name]++
+
+	s.wg.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.logger.Error("Supervised goroutine panicked",
+					zap.String("goroutine", name),
+					zap.Any("panic", r),
+				)
+			}
+			s.mu.Lock()
+			if s.running[name]--; s.running[name] == 0 {
+				delete(s.running, name)
+			}
+			s.mu.Unlock()
+		}()
+		fn(s.ctx)
+	})
+}
+
+// Running returns the names of goroutines that have not returned yet, sorted
+func (s *Supervisor) Running() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.running))
+	for name := range s.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Shutdown cancels the goroutines' context and waits for them until ctx is
+// done. Goroutines still running at the deadline are logged by name and
+// reported in the returned error; they are left running.
+func (s *Supervisor) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		stragglers := s.Running()
+		s.logger.Warn("Supervised goroutines did not finish before shutdown timeout",
+			zap.Strings("goroutines", stragglers),
+		)
+		return fmt.Errorf("%d supervised goroutine(s) still running: %w", len(stragglers), ctx.Err())
+	}
+}
@@ -0,0 +1,66 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/duynhne/user-service/middleware"
+)
+
+func TestSupervisorShutdown(t *testing.T) {
+	t.Run("waits for goroutines that honor ctx", func(t *testing.T) {
+		sup := middleware.NewSupervisor(zap.NewNop())
+		stopped := make(chan struct{})
+		sup.Go("sampler", func(ctx context.Context) {
+			<-ctx.Done()
+			close(stopped)
+		})
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+		if err := sup.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown() error = %v", err)
+		}
+		select {
+		case <-stopped:
+		default:
+			t.Fatal("goroutine did not observe cancellation")
+		}
+		if got := sup.Running(); len(got) != 0 {
+			t.Errorf("Running() = %v, want none", got)
+		}
+	})
+
+	t.Run("reports stragglers on timeout", func(t *testing.T) {
+		sup := middleware.NewSupervisor(zap.NewNop())
+		release := make(chan struct{})
+		defer close(release)
+		sup.Go("stuck", func(context.Context) { <-release })
+
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		err := sup.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Shutdown() error = %v, want DeadlineExceeded", err)
+		}
+		if got, want := sup.Running(), []string{"stuck"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Running() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("recovers panics", func(t *testing.T) {
+		sup := middleware.NewSupervisor(zap.NewNop())
+		sup.Go("boom", func(context.Context) { panic("boom") })
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+		if err := sup.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown() error = %v", err)
+		}
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/duynhne/user-service/config"
@@ -16,7 +15,9 @@ import (
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 var (
@@ -27,13 +28,14 @@ var (
 
 // InitTracing initializes OpenTelemetry tracing using centralized config package
 // Configuration is loaded from environment variables via config.Load()
+// logger (optional) receives warnings such as partial resource detection failures
 //
 // Example:
 //
 //	cfg := config.Load()
-//	tp, err := middleware.InitTracing(cfg)
+//	tp, err := middleware.InitTracing(cfg, logger)
 //	defer tp.Shutdown(context.Background())
-func InitTracing(cfg *config.Config) (*sdktrace.TracerProvider, error) {
+func InitTracing(cfg *config.Config, logger *zap.Logger) (*sdktrace.TracerProvider, error) {
 	// Skip tracing initialization if disabled
 	if !cfg.Tracing.Enabled {
 		return nil, errors.New("tracing is disabled (TRACING_ENABLED=false)")
@@ -48,7 +50,8 @@ func InitTracing(cfg *config.Config) (*sdktrace.TracerProvider, error) {
 	}
 
 	// Create context with timeout for exporter initialization
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	exportTimeout := cfg.Timeouts.OTelExport
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
 	defer cancel()
 
 	// Create OTLP HTTP exporter with compression
@@ -58,6 +61,7 @@ func InitTracing(cfg *config.Config) (*sdktrace.TracerProvider, error) {
 		otlptracehttp.WithEndpoint(cfg.Tracing.Endpoint),
 		otlptracehttp.WithInsecure(), // Use TLS in production
 		otlptracehttp.WithCompression(otlptracehttp.GzipCompression),
+		otlptracehttp.WithTimeout(exportTimeout),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
@@ -65,9 +69,13 @@ func InitTracing(cfg *config.Config) (*sdktrace.TracerProvider, error) {
 
 	// Auto-detect service information from Kubernetes environment
 	// Falls back to cfg.Service.Name if Kubernetes metadata is unavailable
+	// A partial failure still yields a valid fallback resource; log what was lost
 	res, resErr := CreateResource(context.Background())
-	if resErr != nil {
-		_ = resErr // partial failure is acceptable; fallback resource is valid
+	if resErr != nil && logger != nil {
+		logger.Warn("Resource detection failed, using fallback resource",
+			zap.Error(resErr),
+			zap.Strings("defaulted_attributes", MissingResourceAttributes(res)),
+		)
 	}
 
 	// Store detected service name for middleware usage
@@ -78,12 +86,12 @@ func InitTracing(cfg *config.Config) (*sdktrace.TracerProvider, error) {
 
 	// Create tracer provider with batch export configuration
 	// BatchTimeout: How often to flush spans (default: 5s)
-	// ExportTimeout: Max time to wait for export (default: 30s)
+	// ExportTimeout: Max time to wait for export (OTEL_EXPORT_TIMEOUT, default: 30s)
 	// SampleRate: Percentage of traces to sample (10% production, 100% dev)
 	tracerProvider = sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exporter,
 			sdktrace.WithBatchTimeout(5*time.Second),
-			sdktrace.WithExportTimeout(30*time.Second),
+			sdktrace.WithExportTimeout(exportTimeout),
 			sdktrace.WithMaxExportBatchSize(cfg.Tracing.MaxExportBatchSize),
 		),
 		sdktrace.WithResource(res),
@@ -106,18 +114,9 @@ func InitTracing(cfg *config.Config) (*sdktrace.TracerProvider, error) {
 }
 
 // shouldTrace determines if a request should be traced based on path
-// Skips health checks, metrics endpoints, and static resources
+// Skips health checks, metrics endpoints, and static resources (see SetExcludedPaths)
 func shouldTrace(path string) bool {
-	skipPaths := []string{
-		"/health", "/healthz", "/ready", "/readyz", "/livez",
-		"/metrics", "/favicon.ico",
-	}
-	for _, skip := range skipPaths {
-		if strings.HasPrefix(path, skip) {
-			return false
-		}
-	}
-	return true
+	return !isExcludedPath(path)
 }
 
 // TracingMiddleware returns a Gin middleware for OpenTelemetry tracing
@@ -134,9 +133,16 @@ func TracingMiddleware() gin.HandlerFunc {
 	}
 
 	// Wrap otelgin middleware with request filtering
+	// Root request spans also carry k8s.pod.name (not only the resource), so a
+	// single misbehaving replica can be isolated with a span attribute filter
+	var spanOpts []trace.SpanStartOption
+	if podName := DetectPodName(); podName != "" {
+		spanOpts = append(spanOpts, trace.WithAttributes(semconv.K8SPodNameKey.String(podName)))
+	}
 	otelMiddleware := otelgin.Middleware(
 		serviceName,
 		otelgin.WithTracerProvider(otel.GetTracerProvider()),
+		otelgin.WithSpanStartOptions(spanOpts...),
 	)
 
 	return func(c *gin.Context) {
@@ -205,6 +211,18 @@ func Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// ForceFlush exports all spans still buffered by the batch processor without
+// shutting the provider down. It reports false when tracing is not initialized.
+func ForceFlush(ctx context.Context) (flushed bool, err error) {
+	if tracerProvider == nil {
+		return false, nil
+	}
+	if err := tracerProvider.ForceFlush(ctx); err != nil {
+		return false, fmt.Errorf("failed to flush traces: %w", err)
+	}
+	return true, nil
+}
+
 // Helper Functions
 
 // AddSpanAttributes adds attributes to the current span if it's recording